@@ -26,6 +26,10 @@ var ErrTokenInvalid         = ApiError{100, "Client token is invalid. Please mak
 var ErrRequestNotAllowd     = ApiError{101, "The request is not allowed."}
 var ErrBadRequest           = ApiError{102, "Request query or post data not correct."}
 var ErrSearchSyntaxError    = ApiError{103, "Search syntax not correct."}
+var ErrOpmlSyntaxError      = ApiError{104, "OPML document not correct."}
+var ErrFilterSyntaxError    = ApiError{105, "Filter syntax not correct."}
+var ErrRuleSyntaxError      = ApiError{106, "Rule syntax not correct."}
+var ErrImportDataError      = ApiError{107, "Import data not correct."}
 var ErrFetchError           = ApiError{200, "Error occurs when fetching feed. Please check the internet connection and make sure the feed's url is valid."}
 var ErrParseError           = ApiError{201, "Error occurs when parsing feed. Please check if the feed is valid."}
 var ErrQueryDB              = ApiError{300, "Error occurs when querying the database."}
@@ -0,0 +1,143 @@
+package api
+
+import "fmt"
+import "net/http"
+import "github.com/go-martini/martini"
+import httphelper "github.com/m3ng9i/go-utils/http"
+import "github.com/m3ng9i/qreader/global"
+import "github.com/m3ng9i/qreader/model"
+
+
+/*
+Writer of a file to download. Headers of the download are written before the first write, so the response could
+still be an error of json before anything is written.
+*/
+type downloadWriter struct {
+    w           http.ResponseWriter
+    contentType string
+    filename    string
+    written     bool
+}
+
+
+func (this *downloadWriter) Write(p []byte) (int, error) {
+    if !this.written {
+        this.w.Header().Set("Content-Type", this.contentType)
+        this.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, this.filename))
+        this.w.WriteHeader(http.StatusOK)
+        this.written = true
+    }
+    return this.w.Write(p)
+}
+
+
+/*
+Export all the feeds, articles (including read and starred status) and tags in JSON Lines format, see model.ExportData().
+Unlike OPML, the data can be used to move all the reading state to another QReader.
+
+method:     GET
+path:       /api/feed/export/json
+
+The output is a JSON Lines file (qreader.jsonl), it's written while reading a snapshot of the database. If an error
+occurs before writing, the output will be a json string like other apis. If an error occurs while writing, the file is
+truncated, it has no trailer record, so it will be rejected when importing.
+*/
+func ExportData() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        dw := &downloadWriter{w: w, contentType: "application/x-ndjson; charset=utf-8", filename: "qreader.jsonl"}
+
+        n, err := model.ExportData(dw)
+        if err != nil {
+            if !dw.written {
+                result.Error = ErrQueryDB
+                result.IntError = err
+                result.Response(w)
+                return
+            }
+            global.Logger.Errorf("[API] [#%s] Error occurs when exporting data: %s", rid, err.Error())
+            return
+        }
+
+        global.Logger.Debugf("[API Response] [#%s] Data exported, %d feeds, %d articles, %d tags", rid, n.Feeds, n.Items, n.Tags)
+    }
+}
+
+
+/*
+Import data exported by ExportData() and merge it into the database. Existing feeds and articles are not duplicated,
+read and starred status of existing articles are merged. If an error occurs, nothing is imported.
+
+method:     POST
+path:       /api/feed/import/json
+postdata:   content of a file exported by /api/feed/export/json or "qreader -export-json"
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":{"feeds_added":2,"feeds_existing":1,"items_added":120,"items_merged":30,"items_skipped":0,"tags_added":3}}
+*/
+func ImportData() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        report, err := model.ImportData(r.Body)
+        if err != nil {
+            if _, ok := err.(*model.ImportDataError); ok {
+                result.Error = ErrImportDataError
+            } else {
+                result.Error = ErrQueryDB
+            }
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        global.Logger.Infof("[API] [#%s] Data imported: %d feeds, %d articles added.", rid, report.FeedsAdded, report.ItemsAdded)
+
+        result.Success = true
+        result.Result = report
+        result.Response(w)
+    }
+}
+
+
+/*
+Import starred articles exported by other readers: Google Reader style starred.json (FreshRSS, Inoreader etc.)
+or Netscape bookmark file exported by browsers. The format is detected by content, see model.ImportStarred().
+
+method:     POST
+path:       /api/feed/import/starred
+postdata:   content of a starred.json or bookmark file
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":{"format":"starred.json","imported":120,"duplicated":3,"rejected":1,"feeds":5,"errors":["'' (...) is not a http url."]}}
+*/
+func ImportStarred() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        report, err := model.ImportStarred(r.Body)
+        if err != nil {
+            if _, ok := err.(*model.ImportDataError); ok {
+                result.Error = ErrImportDataError
+            } else {
+                result.Error = ErrQueryDB
+            }
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        global.Logger.Infof("[API] [#%s] Starred articles imported from %s: %d imported, %d duplicated, %d rejected.",
+            rid, report.Format, report.Imported, report.Duplicated, report.Rejected)
+
+        result.Success = true
+        result.Result = report
+        result.Response(w)
+    }
+}
@@ -4,6 +4,7 @@ import "net/http"
 import "strconv"
 import "strings"
 import "fmt"
+import "time"
 import "encoding/json"
 import "github.com/go-martini/martini"
 import httphelper "github.com/m3ng9i/go-utils/http"
@@ -45,7 +46,68 @@ func IsSubscribed() martini.Handler {
 
 
 /*
-Subscribe a feed.
+Discover feeds of a url, the url could be a feed or a web page, see model.DiscoverFeed().
+The client could pick one of the candidates and subscribe it.
+
+method:     GET
+path:       /api/feed/discover?url={}
+example:    /api/feed/discover?url=http://mengqi.info
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":[{"url":"http://mengqi.info/feed.xml","title":"My*Candy","type":"rss","source":"link","subscribed":false}]}
+
+source is "url" if the url itself is a feed, "link" if declared by <link rel="alternate"> in the web page,
+"path" if found at a common path like /feed. Candidates of "link" are not fetched, so they may be unavailable.
+*/
+func DiscoverFeed() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        r.ParseForm()
+        url := httphelper.QueryValue(r, "url")
+        if url == "" {
+            result.Error = ErrBadRequest
+            result.IntError = fmt.Errorf("Parameter 'url' is empty.")
+            result.Response(w)
+            return
+        }
+
+        candidates, err := model.DiscoverFeed(url)
+        if err != nil {
+            if _, ok := err.(*model.FetchError); ok {
+                result.Error = ErrFetchError
+            } else if err == model.ErrNotHttpUrl {
+                result.Error = ErrBadRequest
+            } else {
+                result.Error = ErrQueryDB
+            }
+            result.Result = url
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if len(candidates) == 0 {
+            result.Error = ErrNoResultsFound
+            result.IntError = fmt.Errorf("No feeds found in '%s'.", url)
+            result.Response(w)
+            return
+        }
+
+        for i, _ := range candidates {
+            utils.SanitizeSelf(&candidates[i].Title)
+        }
+
+        result.Success = true
+        result.Result = candidates
+        result.Response(w)
+    }
+}
+
+
+/*
+Subscribe a feed. url should be a feed, if it's a web page, use /api/feed/discover to find feeds in it first.
 
 method:     POST
 path:       /api/feed/subscription?url={}
@@ -86,7 +148,7 @@ func Subscribe() martini.Handler {
         if err != nil {
             result.Success = false
 
-            if _, ok := err.(*feedreader.ParseError); ok {
+            if model.IsParseError(err) {
                 result.Error = ErrParseError
             } else {
                 result.Error = ErrFetchError
@@ -136,13 +198,28 @@ path:       /api/feed/feedlist
 The output is like:
 {"request_id":"a02d1d1b06cb38bcb4cc248da7d21ba3","success":true,"error":{"errcode":0,"errmsg":""},"result":[{"feed_id":1,"feed_name":"cnBeta.COM业界资讯","feed_feed_url":"http://cnbeta.feedsportal.com/c/34306/f/624776/index.rss","feed_url":"http://www.cnbeta.com","feed_desc":"cnBeta.COM - 简明IT新闻,网友媒体与言论平台","feed_type":"rss","feed_interval":0,"feed_last_fetch":"2015-03-15T19:07:16+08:00","feed_last_failed":"0001-01-01T08:00:00+08:00","feed_last_error":"","feed_max_number":0,"feed_filter":"","feed_use_proxy":false,"feed_note":"","unread":60},{"feed_id":2,"feed_name":"My*Candy","feed_feed_url":"http://mengqi.info/feed.xml","feed_url":"http://mengqi.info","feed_desc":"","feed_type":"atom","feed_interval":0,"feed_last_fetch":"2015-03-15T19:48:13+08:00","feed_last_failed":"0001-01-01T08:00:00+08:00","feed_last_error":"","feed_max_number":0,"feed_filter":"","feed_use_proxy":false,"feed_note":"","unread":0},{"feed_id":3,"feed_name":"Startup News","feed_feed_url":"http://news.dbanotes.net/rss","feed_url":"http://news.dbanotes.net/","feed_desc":"Startup News of China","feed_type":"rss","feed_interval":0,"feed_last_fetch":"2015-03-19T19:36:40+08:00","feed_last_failed":"0001-01-01T08:00:00+08:00","feed_last_error":"","feed_max_number":0,"feed_filter":"","feed_use_proxy":false,"feed_note":"","unread":395},{"feed_id":4,"feed_name":"于江水","feed_feed_url":"http://yujiangshui.com/atom.xml","feed_url":"http://yujiangshui.com/","feed_desc":"一入前端深似海。","feed_type":"atom","feed_interval":0,"feed_last_fetch":"2015-03-19T19:39:09+08:00","feed_last_failed":"0001-01-01T08:00:00+08:00","feed_last_error":"","feed_max_number":0,"feed_filter":"","feed_use_proxy":false,"feed_note":"","unread":20}]}
 
+
+Add "searches" parameter to get saved searches with unread numbers too (see /api/searches), they are counted in
+the same transaction as feeds, e.g. /api/feed/list?searches=1, the output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":{"feeds":[{"feed_id":1,...,"unread":60}],"searches":[{"saved_search_id":1,...,"unread":12}]}}
 */
 func FeedList() martini.Handler {
-    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
         var result Result
         result.RequestId = rid
 
-        feedList, err := model.GetFeedListWithAmount(nil)
+        r.ParseForm()
+        withSearches := httphelper.QueryValue(r, "searches") != ""
+
+        var feedList []*model.FeedWithAmount
+        var searchList []*model.SavedSearchWithAmount
+        var err error
+        if withSearches {
+            feedList, searchList, err = model.GetFeedAndSavedSearchList()
+        } else {
+            feedList, err = model.GetFeedListWithAmount(nil)
+        }
         if err != nil {
             result.Error = ErrQueryDB
             result.IntError = err
@@ -156,7 +233,26 @@ func FeedList() martini.Handler {
         }
 
         result.Success = true
-        result.Result = feedList
+
+        if withSearches {
+            if searchList == nil {
+                searchList = []*model.SavedSearchWithAmount{}
+            }
+            for i, _ := range searchList {
+                utils.SanitizeSelf(&searchList[i].Name)
+            }
+
+            var t struct {
+                Feeds       []*model.FeedWithAmount         `json:"feeds"`
+                Searches    []*model.SavedSearchWithAmount  `json:"searches"`
+            }
+            t.Feeds = feedList
+            t.Searches = searchList
+            result.Result = t
+        } else {
+            result.Result = feedList
+        }
+
         result.Response(w)
     }
 }
@@ -173,6 +269,7 @@ example:
     /api/article/list/random?n=20
 
 You can control the number of results returned by add a "n" parameter, default number is 10.
+Add "excerpt" parameter to get plain text excerpts of content, see articleExcerpts().
 */
 func RandomArticleList() martini.Handler {
     return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
@@ -199,6 +296,14 @@ func RandomArticleList() martini.Handler {
             utils.SanitizeSelf(&list.Articles[i].Title)
         }
 
+        err = articleExcerpts(r, list.Articles)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
         result.Success = true
         result.Result = list
         result.Response(w)
@@ -212,6 +317,10 @@ Get one article.
 method:     GET
 path:       /api/article/{article id}
 example:    /api/article/1
+result:     article:    the article
+            related:    other articles to read
+            same:       the same article (same url) in other feeds
+            revisions:  number of previous versions of the article, see ArticleRevisions()
 */
 func Article() martini.Handler {
     return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
@@ -265,6 +374,23 @@ func Article() martini.Handler {
             return
         }
 
+        // The same article in other feeds
+        same, err := model.GetSameArticles(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        revisions, err := model.CountItemRevisions(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
         utils.SanitizeSelf(&article.Name)
         utils.SanitizeSelf(&article.Author)
         utils.SanitizeSelf(&article.Title)
@@ -276,12 +402,22 @@ func Article() martini.Handler {
             utils.SanitizeSelf(&related[i].Title)
         }
 
+        for i := range same {
+            utils.SanitizeSelf(&same[i].Name)
+            utils.SanitizeSelf(&same[i].Author)
+            utils.SanitizeSelf(&same[i].Title)
+        }
+
         var t struct {
             Article *model.Article `json:"article"`
             Related []*model.Article `json:"related"`
+            Same    []*model.Article `json:"same"`
+            Revisions int64 `json:"revisions"`
         }
         t.Article = article
         t.Related = related
+        t.Same = same
+        t.Revisions = revisions
 
         result.Success = true
         result.Result = t
@@ -290,6 +426,86 @@ func Article() martini.Handler {
 }
 
 
+/*
+Get previous versions of an article, whose title or content has been changed by the publisher.
+Revisions are ordered from the oldest, each has a word diff of title and content (as plain text) against the next version,
+the next version of the last revision is the current article. Texts in diffs are html escaped.
+
+method:     GET
+path:       /api/article/revisions/{article id}
+example:    /api/article/revisions/1
+result:     [{"revision_id":1, "revision_update_time":"...", "revision_title":"...",
+              "title_diff":[{"op":"=", "text":"..."}, {"op":"-", "text":"..."}, {"op":"+", "text":"..."}],
+              "content_diff":[...]}]
+*/
+func ArticleRevisions() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := strconv.ParseInt(params["id"], 10, 64)
+        if err != nil || id <= 0 {
+            result.Error = ErrBadRequest
+            if err != nil {
+                result.IntError = err
+            } else {
+                result.IntError = fmt.Errorf("Parameter 'id' is not correct.")
+            }
+            result.Response(w)
+            return
+        }
+
+        article, ok, err := model.GetArticle(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoResultsFound
+            result.IntError = fmt.Errorf("Article of id:%d is not found.", id)
+            result.Response(w)
+            return
+        }
+
+        revisions, err := model.GetItemRevisions(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        type revision struct {
+            Id          int64           `json:"revision_id"`
+            UpdateTime  time.Time       `json:"revision_update_time"`
+            Title       string          `json:"revision_title"`
+            TitleDiff   []utils.DiffOp  `json:"title_diff"`
+            ContentDiff []utils.DiffOp  `json:"content_diff"`
+        }
+
+        list := make([]revision, len(revisions))
+        for i, r := range revisions {
+            nextTitle, nextContent := article.Title, article.Content
+            if i + 1 < len(revisions) {
+                nextTitle, nextContent = revisions[i + 1].Title, revisions[i + 1].Content
+            }
+
+            list[i].Id          = r.Id
+            list[i].UpdateTime  = r.UpdateTime
+            list[i].Title       = utils.Sanitize(r.Title)
+            list[i].TitleDiff   = utils.DiffWords(utils.PlainText(r.Title), utils.PlainText(nextTitle))
+            list[i].ContentDiff = utils.DiffWords(utils.PlainText(r.Content), utils.PlainText(nextContent))
+        }
+
+        result.Success = true
+        result.Result = list
+        result.Response(w)
+    }
+}
+
+
 /*
 Mark article read or unread.
 method:     PUT
@@ -351,7 +567,36 @@ func readJsonPost(r *http.Request, data interface{}) error {
 }
 
 
-/* Mark articles read, by ids, feedid or tag
+// Max length of excerpt could be requested by query parameter "excerpt".
+const maxExcerptLength = 1000
+
+
+/*
+Add plain text excerpts to articles if query parameter "excerpt" is provided, e.g. excerpt=200 for excerpts of 200 characters.
+r.ParseForm() should be called before.
+*/
+func articleExcerpts(r *http.Request, articles []*model.Article) (err error) {
+    n, _ := strconv.Atoi(httphelper.QueryValue(r, "excerpt"))
+    if n <= 0 {
+        return
+    }
+    if n > maxExcerptLength {
+        n = maxExcerptLength
+    }
+
+    err = model.LoadExcerpts(articles, n)
+    if err != nil {
+        return
+    }
+
+    for i, _ := range articles {
+        articles[i].Excerpt = utils.Excerpt(articles[i].Excerpt, n)
+    }
+    return
+}
+
+
+/* Mark articles read, by ids, feedid, tag or saved search
 
 by ids:
 method:     PUT
@@ -368,6 +613,11 @@ method:     PUT
 path:       /api/articles/read
 postdata:   {"type":"tag", "value":"blog"}
 
+by saved search (the value is id of the saved search):
+method:     PUT
+path:       /api/articles/read
+postdata:   {"type":"search", "value":3}
+
 
 The output is like:
 {"request_id":"5075115ebec5a26119eaac5e226dc6cc","success":true,"error":{"errcode":0,"errmsg":""},"result":{"affected":0}}
@@ -392,7 +642,7 @@ func MarkArticlesRead() martini.Handler {
 
         var affected int64
 
-        // data.Type will be "ids", "feedid", or "tag"
+        // data.Type will be "ids", "feedid", "tag" or "search"
         if data.Type == "ids" {
             respError := func() {
                 var r Result
@@ -456,6 +706,18 @@ func MarkArticlesRead() martini.Handler {
 
             affected, err = model.MarkArticlesReadByTag(value)
 
+        } else if data.Type == "search" {
+
+            value, ok := data.Value.(float64)
+            if !ok {
+                result.Error = ErrBadRequest
+                result.IntError = fmt.Errorf("'search' is not correct.")
+                result.Response(w)
+                return
+            }
+
+            affected, err = model.MarkArticlesReadBySavedSearch(int64(value))
+
         }
 
         if err != nil {
@@ -519,9 +781,11 @@ func Update() martini.Handler {
 
                 if err == model.ErrFeedHasNoItems {
                     result.Error = ErrFetchError
+                } else if _, ok := err.(*model.FetchError); ok {
+                    result.Error = ErrFetchError
                 } else if _, ok := err.(*feedreader.FetchError); ok {
                     result.Error = ErrFetchError
-                } else if _, ok := err.(*feedreader.ParseError); ok {
+                } else if model.IsParseError(err) {
                     result.Error = ErrParseError
                 } else {
                     result.Error = ErrUnexpectedError
@@ -547,19 +811,30 @@ method:     GET
 
 route:      unread
 path:       /api/articles/unread/{limit}/{offset}
+            /api/articles/unread/{limit}?cursor={cursor}
 example:    /api/articles/unread/10/100
 
 route:      fid
 path:       /api/articles/fid/{fid}/{limit}/{offset}
+            /api/articles/fid/{fid}/{limit}?cursor={cursor}
 example:    /api/articles/fid/12/10/100
 
 route:      tag
 path:       /api/articles/tag/{tag}/{limit}/{offset}
+            /api/articles/tag/{tag}/{limit}?cursor={cursor}
 example:    /api/articles/tag/blog/10/100
 
 route:      starred
 path:       /api/articles/starred/{limit}/{offset}
+            /api/articles/starred/{limit}?cursor={cursor}
 example:    /api/articles/starred/10/100
+
+The result contains "next_cursor", which is the cursor of the next page, or empty if there's no next page.
+Paging by cursor is not affected by articles inserted while paging. The first page could be got without cursor.
+If cursor is provided, offset is ignored.
+
+Content of articles is not included. Add "excerpt" parameter to get plain text excerpts of content,
+e.g. /api/articles/unread/10/0?excerpt=200, the excerpt is in "item_excerpt" of each article.
 */
 func ArticleList(route string) martini.Handler {
     return func(w http.ResponseWriter, r *http.Request, params martini.Params, rid httphelper.RequestId) {
@@ -580,22 +855,27 @@ func ArticleList(route string) martini.Handler {
             return
         }
 
-        offset, err := strconv.Atoi(params["offset"])
-        if err != nil || offset < 0 {
-            result.Error = ErrBadRequest
-            if err != nil {
-                result.IntError = err
-            } else {
-                result.IntError = fmt.Errorf("Parameter 'offset' is not correct.")
+        offset := 0
+        if _, ok := params["offset"]; ok {
+            offset, err = strconv.Atoi(params["offset"])
+            if err != nil || offset < 0 {
+                result.Error = ErrBadRequest
+                if err != nil {
+                    result.IntError = err
+                } else {
+                    result.IntError = fmt.Errorf("Parameter 'offset' is not correct.")
+                }
+                result.Response(w)
+                return
             }
-            result.Response(w)
-            return
         }
 
+        cursor := httphelper.QueryValue(r, "cursor")
+
         var list model.ArticleList
 
         if route == "unread" {
-            list, err = model.GetArticleList(limit, offset)
+            list, err = model.GetArticleList(limit, offset, cursor)
 
         } else if route == "fid" {
             var fid int64
@@ -611,13 +891,13 @@ func ArticleList(route string) martini.Handler {
                 return
             }
 
-            list, err = model.GetArticleListByFid(fid, limit, offset)
+            list, err = model.GetArticleListByFid(fid, limit, offset, cursor)
 
         } else if route == "tag" {
-            list, err = model.GetArticleListByTag(params["tag"], limit, offset)
+            list, err = model.GetArticleListByTag(params["tag"], limit, offset, cursor)
 
         } else if route == "starred" {
-            list ,err = model.GetStarredArticleList(limit, offset)
+            list ,err = model.GetStarredArticleList(limit, offset, cursor)
 
         } else {
             result.Error = ErrUnexpectedError
@@ -627,7 +907,11 @@ func ArticleList(route string) martini.Handler {
         }
 
         if err != nil {
-            result.Error = ErrQueryDB
+            if err == model.ErrInvalidCursor {
+                result.Error = ErrBadRequest
+            } else {
+                result.Error = ErrQueryDB
+            }
             result.IntError = err
             result.Response(w)
             return
@@ -645,6 +929,14 @@ func ArticleList(route string) martini.Handler {
             utils.SanitizeSelf(&list.Articles[i].Title)
         }
 
+        err = articleExcerpts(r, list.Articles)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
         result.Success = true
         result.Result = list
         result.Response(w)
@@ -656,7 +948,11 @@ func ArticleList(route string) martini.Handler {
 Article list of search result.
 
 path:       /api/articles/search/{deflimit}?q={query}&page={page}
+            /api/articles/search/{deflimit}?q={query}&cursor={cursor}
 example:    /api/articles/search/10?q=num:20&page=10
+
+If cursor is provided, page is ignored. Cursor could not be used when the result is ordered by rank or content.
+"excerpt" parameter is the same as ArticleList().
 */
 func SearchList() martini.Handler {
 
@@ -696,9 +992,15 @@ func SearchList() martini.Handler {
             sq.Num = &limit
         }
 
-        list, err := sq.List(page)
+        list, err := sq.List(page, httphelper.QueryValue(r, "cursor"))
         if err != nil {
-            result.Error = ErrQueryDB
+            if _, ok := err.(*model.SearchQueryError); ok {
+                result.Error = ErrSearchSyntaxError
+            } else if err == model.ErrInvalidCursor {
+                result.Error = ErrBadRequest
+            } else {
+                result.Error = ErrQueryDB
+            }
             result.IntError = err
             result.Response(w)
             return
@@ -717,6 +1019,14 @@ func SearchList() martini.Handler {
             utils.SanitizeSelf(&list.Articles[i].Title)
         }
 
+        err = articleExcerpts(r, list.Articles)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
         var t struct {
             model.ArticleList
             Limit int `json:"limit"` // used for paging
@@ -736,6 +1046,9 @@ func SearchList() martini.Handler {
 method:     GET
 path:       /api/feed/id/{id}
 example:    /api/feed/id/1
+
+The result includes number of consecutive failed fetches (feed_fail_count) and time of next scheduled fetch (NextFetch),
+NextFetch is null if the feed is suspended or not going to be updated.
 */
 func FeedInfo() martini.Handler {
     return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
@@ -782,12 +1095,18 @@ func FeedInfo() martini.Handler {
 
 /*
 Update table Feed and Tag.
-Affected columns: Feed.FeedUrl, Feed.Note, Tag.Name, Tag.Fid.
+Affected columns: Feed.FeedUrl, Feed.Note, Feed.Filter, Tag.Name, Tag.Fid.
+
+If feed_filter is not provided, Feed.Filter will not be changed. Rules of feed_filter are separated by newline or ';',
+e.g. "title:sponsored -> read; author:alice -> star", see model.FilterRule for the syntax.
+If feed_mark_updated_unread is true, articles changed by the publisher will be marked unread again, it will not be
+changed if not provided.
 
 method:     PUT
 path:       /api/feed/id/{id}
 example:    /api/feed/id/1
-postdata:   {"alias":"xxx", "feed_url":"xxx", "feed_note":"xxx", "tags":["t1", "t2"]}
+postdata:   {"alias":"xxx", "feed_url":"xxx", "feed_note":"xxx", "feed_filter":"xxx", "feed_mark_updated_unread":false,
+             "tags":["t1", "t2"]}
 */
 func UpdateFeedAndTags() martini.Handler {
     return func(w http.ResponseWriter, params martini.Params, r *http.Request, rid httphelper.RequestId) {
@@ -813,6 +1132,8 @@ func UpdateFeedAndTags() martini.Handler {
             FeedMaxKeep     uint        `json:"feed_max_keep"`
             FeedMaxUnread   uint        `json:"feed_max_unread"`
             FeedInterval    int         `json:"feed_interval"`
+            FeedFilter      *string     `json:"feed_filter"`
+            FeedMarkUpdatedUnread *bool `json:"feed_mark_updated_unread"`
             Tags            []string    `json:"tags"`
         }
         err = readJsonPost(r, &data)
@@ -823,6 +1144,16 @@ func UpdateFeedAndTags() martini.Handler {
             return
         }
 
+        if data.FeedFilter != nil {
+            _, err = model.ParseFilter(*data.FeedFilter)
+            if err != nil {
+                result.Error = ErrFilterSyntaxError
+                result.IntError = err
+                result.Response(w)
+                return
+            }
+        }
+
         var feed model.Feed
         feed.Alias      = &data.FeedAlias
         feed.FeedUrl    = data.FeedUrl
@@ -830,6 +1161,8 @@ func UpdateFeedAndTags() martini.Handler {
         feed.MaxKeep    = &data.FeedMaxKeep
         feed.MaxUnread  = &data.FeedMaxUnread
         feed.Interval   = &data.FeedInterval
+        feed.Filter     = data.FeedFilter
+        feed.MarkUpdatedUnread = data.FeedMarkUpdatedUnread
 
         ok, err := model.UpdateFeed(id, &feed)
         if err != nil {
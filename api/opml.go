@@ -0,0 +1,81 @@
+package api
+
+import "bytes"
+import "net/http"
+import "github.com/go-martini/martini"
+import httphelper "github.com/m3ng9i/go-utils/http"
+import "github.com/m3ng9i/qreader/global"
+import "github.com/m3ng9i/qreader/model"
+
+
+/*
+Import feeds from an OPML document. Folders in the document will be saved as tags.
+
+method:     POST
+path:       /api/feed/import/opml
+postdata:   content of an OPML file
+
+The output is like:
+{"request_id":"9d0b7a4e1f3c2b8a6d5e4f3a2b1c0d9e","success":true,"error":{"errcode":0,"errmsg":""},"result":[{"url":"http://mengqi.info/feed.xml","name":"My*Candy","tags":["blog"],"status":"subscribed","id":5,"number":10,"error":""},{"url":"http://news.dbanotes.net/rss","name":"Startup News","tags":null,"status":"already subscribed","id":0,"number":0,"error":""}]}
+
+Status of each feed may be: "subscribed", "already subscribed", "fetch error", "parse error" or "database error".
+*/
+func ImportOpml() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        report, err := model.ImportOpml(r.Body)
+        if err != nil {
+            result.Error = ErrOpmlSyntaxError
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = report
+        result.Response(w)
+    }
+}
+
+
+/*
+Export subscriptions as an OPML document. Feeds are grouped into folders by tag, QReader's settings of each feed
+are saved as extension attributes, so the document can be imported into another QReader without losing data.
+
+method:     GET
+path:       /api/feed/export/opml
+
+The output is an OPML file (qreader.opml). If an error occurs, the output will be a json string like other apis.
+*/
+func ExportOpml() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        opml, err := model.ExportOpml()
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        var buf bytes.Buffer
+        err = opml.Write(&buf)
+        if err != nil {
+            result.Error = ErrSystemError
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+        w.Header().Set("Content-Disposition", `attachment; filename="qreader.opml"`)
+        w.WriteHeader(http.StatusOK)
+        w.Write(buf.Bytes())
+
+        global.Logger.Debugf("[API Response] [#%s] OPML exported, %d bytes", rid, buf.Len())
+    }
+}
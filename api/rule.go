@@ -0,0 +1,291 @@
+package api
+
+import "fmt"
+import "net/http"
+import "strconv"
+import "github.com/go-martini/martini"
+import httphelper "github.com/m3ng9i/go-utils/http"
+import "github.com/m3ng9i/qreader/model"
+
+
+// Get id of rule, saved search, etc. in the path.
+func pathId(params martini.Params) (id int64, err error) {
+    id, err = strconv.ParseInt(params["id"], 10, 64)
+    if err == nil && id <= 0 {
+        err = fmt.Errorf("Parameter 'id' is not correct.")
+    }
+    return
+}
+
+
+// Read a rule in post data. If rule_enabled is not provided, the rule is enabled.
+func readRulePost(r *http.Request) (rule *model.Rule, err error) {
+    var data struct {
+        Name        string  `json:"rule_name"`
+        Condition   string  `json:"rule_condition"`
+        Action      string  `json:"rule_action"`
+        Enabled     *bool   `json:"rule_enabled"`
+    }
+    err = readJsonPost(r, &data)
+    if err != nil {
+        return
+    }
+
+    rule = &model.Rule{
+        Name:       data.Name,
+        Condition:  data.Condition,
+        Action:     data.Action,
+        Enabled:    true,
+    }
+    if data.Enabled != nil {
+        rule.Enabled = *data.Enabled
+    }
+    return
+}
+
+
+// Set result.Error by err returned by functions of rule.
+func ruleError(result *Result, err error) {
+    if _, ok := err.(*model.RuleSyntaxError); ok {
+        result.Error = ErrRuleSyntaxError
+    } else {
+        result.Error = ErrQueryDB
+    }
+    result.IntError = err
+}
+
+
+/*
+Get all the rules.
+
+method:     GET
+path:       /api/rules
+*/
+func RuleList() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        rules, err := model.GetRuleList()
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        if rules == nil {
+            rules = []*model.Rule{}
+        }
+
+        result.Success = true
+        result.Result = rules
+        result.Response(w)
+    }
+}
+
+
+/*
+Add a rule. Rules are applied on new items of all the feeds.
+
+method:     POST
+path:       /api/rules
+postdata:   {"rule_name":"ads", "rule_condition":"tag:news title:\"/^\\[AD\\]/\"", "rule_action":"read", "rule_enabled":true}
+
+rule_condition uses the syntax of search query, see model.Condition. rule_action are comma separated actions:
+read, star, tag:<name>. If rule_enabled is not provided, the rule will be enabled.
+
+The output is like: {"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},"result":{"id":1}}
+*/
+func AddRule() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        rule, err := readRulePost(r)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        id, err := model.AddRule(rule)
+        if err != nil {
+            ruleError(&result, err)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = map[string]int64{"id": id}
+        result.Response(w)
+    }
+}
+
+
+/*
+Get a rule by rule id.
+
+method:     GET
+path:       /api/rules/id/{id}
+example:    /api/rules/id/1
+*/
+func Rule() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        rule, ok, err := model.GetRule(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoResultsFound
+            result.IntError = fmt.Errorf(ErrNoResultsFound.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = rule
+        result.Response(w)
+    }
+}
+
+
+/*
+Update a rule, all the fields of the rule are replaced by post data.
+
+method:     PUT
+path:       /api/rules/id/{id}
+example:    /api/rules/id/1
+postdata:   {"rule_name":"xxx", "rule_condition":"xxx", "rule_action":"xxx", "rule_enabled":false}
+*/
+func UpdateRule() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        rule, err := readRulePost(r)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ok, err := model.UpdateRule(id, rule)
+        if err != nil {
+            ruleError(&result, err)
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoDataChanged
+            result.IntError = fmt.Errorf(ErrNoDataChanged.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Response(w)
+    }
+}
+
+
+/*
+Delete a rule. Actions have been applied by the rule will not be reverted.
+
+method:     DELETE
+path:       /api/rules/id/{id}
+example:    /api/rules/id/1
+*/
+func DeleteRule() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ok, err := model.DeleteRule(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoDataChanged
+            result.IntError = fmt.Errorf(ErrNoDataChanged.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Response(w)
+    }
+}
+
+
+/*
+Report which existing articles a rule would match, nothing will be changed. The rule does not need to be saved.
+
+method:     POST
+path:       /api/rules/dryrun
+postdata:   {"rule_condition":"xxx", "rule_action":"xxx"}
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":{"number":1,"items":[{"item_id":5,"item_fid":2,"item_title":"xxx","item_url":"xxx","item_read":false,"item_starred":false}]}}
+*/
+func DryRunRule() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        rule, err := readRulePost(r)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        report, err := model.DryRunRule(rule)
+        if err != nil {
+            ruleError(&result, err)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = report
+        result.Response(w)
+    }
+}
@@ -0,0 +1,342 @@
+package api
+
+import "fmt"
+import "net/http"
+import "strconv"
+import "github.com/go-martini/martini"
+import httphelper "github.com/m3ng9i/go-utils/http"
+import "github.com/m3ng9i/qreader/model"
+import "github.com/m3ng9i/qreader/utils"
+
+
+// Read a saved search in post data.
+func readSavedSearchPost(r *http.Request) (ss *model.SavedSearch, err error) {
+    var data struct {
+        Name        string  `json:"saved_search_name"`
+        Query       string  `json:"saved_search_query"`
+        PageSize    int     `json:"saved_search_page_size"`
+    }
+    err = readJsonPost(r, &data)
+    if err != nil {
+        return
+    }
+
+    if data.Name == "" {
+        err = fmt.Errorf("'saved_search_name' is empty.")
+        return
+    }
+    if data.PageSize < 0 {
+        err = fmt.Errorf("'saved_search_page_size' is not correct.")
+        return
+    }
+
+    ss = &model.SavedSearch{
+        Name:       data.Name,
+        Query:      data.Query,
+        PageSize:   data.PageSize,
+    }
+    return
+}
+
+
+// Set result.Error by err returned by functions of saved search.
+func savedSearchError(result *Result, err error) {
+    if _, ok := err.(*model.SearchQueryError); ok {
+        result.Error = ErrSearchSyntaxError
+    } else if err == model.ErrInvalidCursor {
+        result.Error = ErrBadRequest
+    } else {
+        result.Error = ErrQueryDB
+    }
+    result.IntError = err
+}
+
+
+/*
+Get all the saved searches with unread number of each search.
+
+method:     GET
+path:       /api/searches
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},
+ "result":[{"saved_search_id":1,"saved_search_name":"golang","saved_search_query":"tag:tech go","saved_search_page_size":20,"unread":12}]}
+*/
+func SavedSearchList() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        list, err := model.GetSavedSearchListWithAmount(nil)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        if list == nil {
+            list = []*model.SavedSearchWithAmount{}
+        }
+
+        for i, _ := range list {
+            utils.SanitizeSelf(&list[i].Name)
+        }
+
+        result.Success = true
+        result.Result = list
+        result.Response(w)
+    }
+}
+
+
+/*
+Add a saved search. The query is checked by the search syntax, see model.Search().
+
+method:     POST
+path:       /api/searches
+postdata:   {"saved_search_name":"golang", "saved_search_query":"tag:tech go", "saved_search_page_size":20}
+
+If saved_search_page_size is 0 or not provided, "num" of the query will be used, or the client decides the page size.
+
+The output is like: {"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},"result":{"id":1}}
+*/
+func AddSavedSearch() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        ss, err := readSavedSearchPost(r)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        id, err := model.AddSavedSearch(ss)
+        if err != nil {
+            savedSearchError(&result, err)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = map[string]int64{"id": id}
+        result.Response(w)
+    }
+}
+
+
+/*
+Get a saved search by id.
+
+method:     GET
+path:       /api/searches/id/{id}
+example:    /api/searches/id/1
+*/
+func SavedSearch() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ss, ok, err := model.GetSavedSearch(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoResultsFound
+            result.IntError = fmt.Errorf(ErrNoResultsFound.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        utils.SanitizeSelf(&ss.Name)
+
+        result.Success = true
+        result.Result = ss
+        result.Response(w)
+    }
+}
+
+
+/*
+Update a saved search, all the fields of the saved search are replaced by post data.
+
+method:     PUT
+path:       /api/searches/id/{id}
+example:    /api/searches/id/1
+postdata:   {"saved_search_name":"xxx", "saved_search_query":"xxx", "saved_search_page_size":10}
+*/
+func UpdateSavedSearch() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, r *http.Request, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ss, err := readSavedSearchPost(r)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ok, err := model.UpdateSavedSearch(id, ss)
+        if err != nil {
+            savedSearchError(&result, err)
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoDataChanged
+            result.IntError = fmt.Errorf(ErrNoDataChanged.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Response(w)
+    }
+}
+
+
+/*
+Delete a saved search. Articles matched by the search are not affected.
+
+method:     DELETE
+path:       /api/searches/id/{id}
+example:    /api/searches/id/1
+*/
+func DeleteSavedSearch() martini.Handler {
+    return func(w http.ResponseWriter, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        ok, err := model.DeleteSavedSearch(id)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+        if !ok {
+            result.Error = ErrNoDataChanged
+            result.IntError = fmt.Errorf(ErrNoDataChanged.ErrMsg)
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Response(w)
+    }
+}
+
+
+/*
+Get article list of a saved search, paging and "excerpt" parameter are the same as ArticleList().
+
+method:     GET
+path:       /api/articles/saved/{id}/{limit}/{offset}
+            /api/articles/saved/{id}/{limit}?cursor={cursor}
+example:    /api/articles/saved/1/10/100
+*/
+func SavedSearchArticleList() martini.Handler {
+    return func(w http.ResponseWriter, r *http.Request, params martini.Params, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        id, err := pathId(params)
+        if err != nil {
+            result.Error = ErrBadRequest
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        limit, err := strconv.Atoi(params["limit"])
+        if err != nil || limit <= 0 {
+            result.Error = ErrBadRequest
+            if err != nil {
+                result.IntError = err
+            } else {
+                result.IntError = fmt.Errorf("Parameter 'limit' is not correct.")
+            }
+            result.Response(w)
+            return
+        }
+
+        offset := 0
+        if _, ok := params["offset"]; ok {
+            offset, err = strconv.Atoi(params["offset"])
+            if err != nil || offset < 0 {
+                result.Error = ErrBadRequest
+                if err != nil {
+                    result.IntError = err
+                } else {
+                    result.IntError = fmt.Errorf("Parameter 'offset' is not correct.")
+                }
+                result.Response(w)
+                return
+            }
+        }
+
+        r.ParseForm()
+        list, ok, err := model.GetArticleListBySavedSearch(id, limit, offset, httphelper.QueryValue(r, "cursor"))
+        if err != nil {
+            savedSearchError(&result, err)
+            result.Response(w)
+            return
+        }
+        if !ok || len(list.Articles) == 0 {
+            result.Error = ErrNoResultsFound
+            result.IntError = fmt.Errorf(ErrNoResultsFound.Error())
+            result.Response(w)
+            return
+        }
+
+        for i, _ := range list.Articles {
+            utils.SanitizeSelf(&list.Articles[i].Name)
+            utils.SanitizeSelf(&list.Articles[i].Author)
+            utils.SanitizeSelf(&list.Articles[i].Title)
+        }
+
+        err = articleExcerpts(r, list.Articles)
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        result.Success = true
+        result.Result = list
+        result.Response(w)
+    }
+}
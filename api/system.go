@@ -1,6 +1,5 @@
 package api
 
-import "os"
 import "net/http"
 import "github.com/go-martini/martini"
 import httphelper "github.com/m3ng9i/go-utils/http"
@@ -22,6 +21,16 @@ func Settings() martini.Handler {
         data["UseProxy"]    = global.UseProxy
         data["Debug"]       = global.Debug
 
+        data["UpdateInterval"]      = global.UpdateInterval
+        data["UpdateCheckPeriod"]   = global.UpdateCheckPeriod
+        data["TrimDataWait"]        = global.TrimDataWait
+        data["FetchConcurrency"]    = global.FetchConcurrency
+        data["RenewQueueSize"]      = global.RenewQueueSize
+        data["FetchBackoffMax"]     = global.FetchBackoffMax
+        data["FetchMaxFailures"]    = global.FetchMaxFailures
+        data["BackupInterval"]      = global.BackupInterval
+        data["BackupKeep"]          = global.BackupKeep
+
         if global.ProxyConfig != nil {
             data["ProxyAddr"] = global.ProxyConfig.Addr
         }
@@ -63,6 +72,7 @@ func Settings() martini.Handler {
         t.DBSize = dbsize
 
         d["Summary"] = t
+        d["Backup"] = model.GetBackupStatus()
         d["Version"] = global.Version
 
         result.Success = true
@@ -82,9 +92,79 @@ func CloseServer() martini.Handler {
         result.Response(w)
 
         global.Logger.Warnf("[API] [#%s] The server is shutdown manually.", result.RequestId)
-        global.Logger.Wait()
-        os.Exit(0)
+        global.Shutdown()
+    }
+}
+
+
+
+
+/*
+Make a backup copy of the database while QReader is running, the file is saved in the "backups" directory of sitedata.
+
+method:     POST
+path:       /api/system/backup
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},"result":{"path":"/path/to/sitedata/backups/feed.20261018150405.db","size":1048576}}
+*/
+func BackupDB() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        path, size, err := model.BackupDBToDir()
+        if err != nil {
+            result.Error = ErrSystemError
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        global.Logger.Infof("[API] [#%s] Database is backed up to %s.", result.RequestId, path)
+
+        result.Success = true
+        result.Result = map[string]interface{}{"path": path, "size": size}
+        result.Response(w)
     }
 }
 
 
+/*
+Rebuild the database file to reclaim unused space.
+
+method:     POST
+path:       /api/system/vacuum
+
+The output is like:
+{"request_id":"...","success":true,"error":{"errcode":0,"errmsg":""},"result":{"before":2097152,"after":1048576,"reclaimed":1048576}}
+*/
+func VacuumDB() martini.Handler {
+    return func(w http.ResponseWriter, rid httphelper.RequestId) {
+        var result Result
+        result.RequestId = rid
+
+        before, after, err := model.VacuumDB()
+        if err != nil {
+            result.Error = ErrQueryDB
+            result.IntError = err
+            result.Response(w)
+            return
+        }
+
+        global.Logger.Infof("[API] [#%s] Database is vacuumed, size: %d -> %d.", result.RequestId, before, after)
+
+        var t struct {
+            Before      int64 `json:"before"`     // size of database before vacuum
+            After       int64 `json:"after"`      // size of database after vacuum
+            Reclaimed   int64 `json:"reclaimed"`  // before - after
+        }
+        t.Before = before
+        t.After = after
+        t.Reclaimed = before - after
+
+        result.Success = true
+        result.Result = t
+        result.Response(w)
+    }
+}
@@ -38,7 +38,8 @@ def buildCmd():
     # current time
     buildFlag.append("-X main._buildTime_ '{}'".format(time.strftime("%Y-%m-%d %H:%M %z")))
 
-    return 'go build -ldflags "{}"'.format(" ".join(buildFlag))
+    # sqlite_fts5: enable full-text search of SQLite
+    return 'go build -tags sqlite_fts5 -ldflags "{}"'.format(" ".join(buildFlag))
 
 if subprocess.call(buildCmd(), shell = True) == 0:
     print("build finished.")
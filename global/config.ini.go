@@ -50,6 +50,36 @@ proxy_password =
 # try: first use normal connection to fetch feed, if got error, try to use proxy to fetch
 # never: use normal connection to fetch feed.
 use_proxy = try
+
+# Default interval (minute) of updating feeds. A feed's own interval can be set on the feed's page.
+update_interval = 120
+
+# Period (minute) of checking which feeds need to update.
+update_check_period = 10
+
+# Seconds to wait after fetching feeds before marking old articles read and deleting old articles.
+trim_data_wait = 60
+
+# Max number of feeds fetched at the same time (1-100).
+fetch_concurrency = 5
+
+# Max number of fetched feeds waiting to be saved to database. Fetching is blocked when the queue is full.
+renew_queue_size = 30
+
+# If fetching a feed failed, QReader will try again 1 hour later, the delay will be doubled after each
+# consecutive failure, until it reaches fetch_backoff_max (minute, at least 60).
+fetch_backoff_max = 1440
+
+# A feed will be suspended (not update any more) after this number of consecutive failures, save the feed settings
+# to resume it. 0 for never suspend.
+fetch_max_failures = 20
+
+# Interval (hour) of automatic backups of database and config.ini, e.g. 24 for daily. 0 for no automatic backup.
+# Backups are saved in the "backups" directory of sitedata.
+backup_interval = 24
+
+# Number of automatic backups to keep (1-1000), older ones are deleted.
+backup_keep = 14
 `
 
 func DefaultConfigIni() string {
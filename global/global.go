@@ -1,6 +1,7 @@
 // Global variables and configuration of QReader.
 package global
 
+import "database/sql"
 import "fmt"
 import "os"
 import "sync"
@@ -8,6 +9,8 @@ import "path/filepath"
 import "strconv"
 import "strings"
 import "net"
+import "net/http"
+import "time"
 import "github.com/Unknwon/goconfig"
 import "github.com/go-xorm/xorm"
 import "github.com/go-xorm/core"
@@ -33,6 +36,7 @@ var Sitedata        string          // Directory of sitedata
 var PathRoot        string          // Root directory of sitedata
 var PathClient      string          // Directory of javascript client
 var PathDB          string          // Path of database
+var PathBackup      string          // Directory of backups
 var PathCertPem     string          // Path of cert.pem
 var PathKeyPem      string          // Path of key.pem
 
@@ -47,14 +51,26 @@ var UseProxy        ProxyType           // if use proxy, always, try or never
 var Debug           bool                // If enable debug mode.
 var Salt            string              // Used for authentication
 var Permission      os.FileMode = 0640  // Permission of generated files
+var FetchBackoffMax uint                // Max delay (minute) before retrying a failed feed
+var FetchMaxFailures uint               // A feed will be suspended after this number of consecutive failures, 0 for never
+var UpdateInterval  uint                // Default interval (minute) of updating feeds
+var UpdateCheckPeriod uint              // Period (minute) of checking which feeds need to update
+var TrimDataWait    uint                // Seconds to wait after fetching feeds before trimming data
+var FetchConcurrency uint               // Max number of feeds fetched at the same time
+var RenewQueueSize  uint                // Buffer size of the queue of fetched feeds waiting to be saved
+var BackupInterval  uint                // Interval (hour) of automatic backups, 0 for no automatic backup
+var BackupKeep      uint                // Number of automatic backups to keep
 var Logger          *log.Logger         // Logger
 var Orm             *xorm.Engine        // Xorm database engine
-var NormalFetcher   *h.Fetcher          // Normal fetcher
-var Socks5Fetcher   *h.Fetcher          // Socks5 proxy fetcher
+var UserAgent       string              // User-Agent header used for fetching feeds
+var NormalClient    *http.Client        // Http client for fetching feeds normally
+var Socks5Client    *http.Client        // Http client for fetching feeds behind socks5 proxy
 var Version         VersionType
 
 var Github          string
 
+const fetchTimeout  = time.Minute       // Timeout of fetching a feed
+
 var loglevel        log.LevelType
 var logfile         string
 
@@ -135,6 +151,31 @@ func loadConfig(filename string) error {
         }
     }
 
+    var uintConfigs = []struct {
+        value   *uint
+        key     string
+        def     int     // default value
+        min     int
+        max     int
+    } {
+        {&FetchBackoffMax,      "fetch_backoff_max",    1440,   60, 43200},
+        {&FetchMaxFailures,     "fetch_max_failures",   20,     0,  10000},
+        {&UpdateInterval,       "update_interval",      120,    1,  43200},
+        {&UpdateCheckPeriod,    "update_check_period",  10,     1,  1440},
+        {&TrimDataWait,         "trim_data_wait",       60,     0,  3600},
+        {&FetchConcurrency,     "fetch_concurrency",    5,      1,  100},
+        {&RenewQueueSize,       "renew_queue_size",     30,     1,  10000},
+        {&BackupInterval,       "backup_interval",      24,     0,  8760},
+        {&BackupKeep,           "backup_keep",          14,     1,  1000},
+    }
+    for _, i := range uintConfigs {
+        v := c.MustInt("", i.key, i.def)
+        if v < i.min || v > i.max {
+            return fmt.Errorf("Value of %s should be between %d and %d.\n", i.key, i.min, i.max)
+        }
+        *i.value = uint(v)
+    }
+
     value := c.MustValue("", "permission")
     p, err := strconv.ParseUint(value, 8, 0)
     if err != nil {
@@ -181,6 +222,37 @@ func getIPAutomaticly() (a string, e error) {
 var once1, once2 sync.Once
 
 
+// Data source name of sqlite database. "PRAGMA foreign_keys=ON" is per connection, so set it by the dsn, it will be
+// executed on every new connection.
+func dataSource(path string) string {
+    return path + "?_foreign_keys=1"
+}
+
+
+/*
+Check if foreign keys are enabled by the dsn. Old versions of go-sqlite3 ignore the "_foreign_keys" parameter
+silently, then deleting a feed will leave its items and tags behind, for they are deleted by cascade.
+An in-memory database is used for the check, so the database file is not created.
+*/
+func checkForeignKeys() error {
+    db, err := sql.Open("sqlite3", dataSource(":memory:"))
+    if err != nil {
+        return err
+    }
+    defer db.Close()
+
+    var enabled int
+    err = db.QueryRow("pragma foreign_keys").Scan(&enabled)
+    if err != nil {
+        return err
+    }
+    if enabled == 0 {
+        return fmt.Errorf("Foreign keys of SQLite cannot be enabled, please build QReader with a newer version of go-sqlite3.\n")
+    }
+    return nil
+}
+
+
 // Init step 1: set path and database
 func Init1() {
     once1.Do(func() {
@@ -193,12 +265,18 @@ func Init1() {
 
         PathClient  = filepath.Join(PathRoot, "client")
         PathDB      = filepath.Join(PathRoot, "feed.db")
+        PathBackup  = filepath.Join(PathRoot, "backups")
         PathCertPem = filepath.Join(PathRoot, "cert", "cert.pem")
         PathKeyPem  = filepath.Join(PathRoot, "cert", "key.pem")
 
         // set database
+        err = checkForeignKeys()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, err.Error())
+            os.Exit(1)
+        }
 
-        Orm, err = xorm.NewEngine("sqlite3", PathDB)
+        Orm, err = xorm.NewEngine("sqlite3", dataSource(PathDB))
         if err != nil {
             fmt.Fprintf(os.Stderr, err.Error())
             os.Exit(1)
@@ -217,19 +295,17 @@ func Init2() {
             os.Exit(1)
         }
 
-        headers := make(map[string]string)
-        headers["User-Agent"] = fmt.Sprintf("QReader %s (%s)", Version.Version, Github)
+        UserAgent = fmt.Sprintf("QReader %s (%s)", Version.Version, Github)
 
-        NormalFetcher = h.NewFetcher(nil, headers)
+        NormalClient = &http.Client{Timeout: fetchTimeout}
 
         if UseProxy != PROXY_NEVER {
-            socks5client, err := h.Socks5Client(*ProxyConfig)
+            Socks5Client, err = h.Socks5Client(*ProxyConfig)
             if err != nil {
                 fmt.Fprintf(os.Stderr, err.Error())
                 os.Exit(1)
             }
-
-            Socks5Fetcher = h.NewFetcher(socks5client, headers)
+            Socks5Client.Timeout = fetchTimeout
         }
 
         if Debug {
@@ -244,3 +320,21 @@ func Init2() {
         }
     })
 }
+
+
+var shutdownOnce sync.Once
+var shutdownChan = make(chan struct{})
+
+
+// Request to shutdown QReader server gracefully. It's safe to call this function more than once.
+func Shutdown() {
+    shutdownOnce.Do(func() {
+        close(shutdownChan)
+    })
+}
+
+
+// Get a channel which will be closed when shutdown is requested.
+func ShutdownRequested() <-chan struct{} {
+    return shutdownChan
+}
@@ -0,0 +1,463 @@
+package model
+
+import "bytes"
+import "context"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+import dbsql "database/sql"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Time format used in names of backup files.
+const backupTimeFormat = "20060102150405"
+
+
+/*
+Make a consistent backup copy of the database while QReader is running. path should not exist.
+
+"vacuum into" is used (SQLite 3.27.0 is required), it reads the database in a transaction, so the backup is consistent
+and compact. The database uses the rollback journal, so writing is blocked while backing up: feeds updated meanwhile
+wait for the busy timeout (5 seconds by default of go-sqlite3), then fail with "database is locked" and will be
+updated again at the next check.
+*/
+func BackupDB(path string) (err error) {
+    _, err = os.Stat(path)
+    if err == nil {
+        err = fmt.Errorf("'%s' already exists.", path)
+        return
+    }
+    if !os.IsNotExist(err) {
+        return
+    }
+
+    _, err = global.Orm.Exec("vacuum into ?", path)
+    if err != nil {
+        return
+    }
+
+    err = os.Chmod(path, global.Permission)
+    return
+}
+
+
+/*
+Make a backup copy of the database in global.PathBackup, the file name is like "feed.20261018150405.db".
+*/
+func BackupDBToDir() (path string, size int64, err error) {
+    err = os.MkdirAll(global.PathBackup, 0755)
+    if err != nil {
+        return
+    }
+
+    path = filepath.Join(global.PathBackup, fmt.Sprintf("feed.%s.db", time.Now().Format(backupTimeFormat)))
+    err = BackupDB(path)
+    if err != nil {
+        return
+    }
+
+    info, err := os.Stat(path)
+    if err != nil {
+        return
+    }
+    size = info.Size()
+    return
+}
+
+
+// Header of SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+
+/*
+Check if a file could be restored as QReader database: it should be a SQLite database which passes integrity check,
+contains tables of QReader, and its schema version is not newer than this QReader supports.
+version is the schema version of the file, migrations will be run on it when QReader starts if it's older.
+*/
+func CheckBackupFile(path string) (version int, err error) {
+    info, err := os.Stat(path)
+    if err != nil {
+        return
+    }
+    if info.IsDir() {
+        err = fmt.Errorf("'%s' is a directory, can not be used as database.", path)
+        return
+    }
+    if info.Size() == 0 {
+        err = fmt.Errorf("Size of '%s' is 0.", path)
+        return
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return
+    }
+    header := make([]byte, len(sqliteHeader))
+    _, err = io.ReadFull(f, header)
+    f.Close()
+    if err != nil || !bytes.Equal(header, sqliteHeader) {
+        err = fmt.Errorf("'%s' is not a SQLite database.", path)
+        return
+    }
+
+    db, err := dbsql.Open("sqlite3", path)
+    if err != nil {
+        return
+    }
+    defer db.Close()
+
+    var result string
+    err = db.QueryRow("pragma integrity_check").Scan(&result)
+    if err != nil {
+        return
+    }
+    if result != "ok" {
+        err = fmt.Errorf("Integrity check of '%s' failed: %s", path, result)
+        return
+    }
+
+    for _, table := range []string{"Feed", "Item", "Tag"} {
+        var count int64
+        err = db.QueryRow("select count(*) from sqlite_master where type = 'table' and name = ?", table).Scan(&count)
+        if err != nil {
+            return
+        }
+        if count == 0 {
+            err = fmt.Errorf("'%s' is not a QReader database: table %s is not found.", path, table)
+            return
+        }
+    }
+
+    version, err = schemaVersion(db)
+    if err != nil {
+        return
+    }
+    if target := TargetSchemaVersion(); version > target {
+        err = fmt.Errorf("Version of '%s' (%d) is newer than this QReader supports (%d).", path, version, target)
+    }
+    return
+}
+
+
+// Copy a file to dst, dst is written to a temporary file first, and then renamed, so it will not be half written.
+func copyFileAtomic(src, dst string) (err error) {
+    in, err := os.Open(src)
+    if err != nil {
+        return
+    }
+    defer in.Close()
+
+    tmp := dst + ".tmp"
+    out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, global.Permission)
+    if err != nil {
+        return
+    }
+
+    _, err = io.Copy(out, in)
+    if err == nil {
+        err = out.Sync()
+    }
+    if e := out.Close(); err == nil {
+        err = e
+    }
+    if err != nil {
+        os.Remove(tmp)
+        return
+    }
+
+    return os.Rename(tmp, dst)
+}
+
+
+/*
+Replace the database by a backup file. QReader server should not be running.
+
+The file is checked by CheckBackupFile() first. If the database exists, a backup copy of it will be made,
+backup is the path of the copy. global.Orm is closed before replacing, it could not be used after restoring.
+*/
+func RestoreDB(path string) (backup string, err error) {
+    _, err = CheckBackupFile(path)
+    if err != nil {
+        return
+    }
+
+    info, err := os.Stat(global.PathDB)
+    if err == nil && info.Size() > 0 {
+        backup = fmt.Sprintf("%s.before-restore.%s.bak", global.PathDB, time.Now().Format(backupTimeFormat))
+        err = BackupDB(backup)
+        if err != nil {
+            err = fmt.Errorf("Cannot backup database before restoring: %s", err.Error())
+            return
+        }
+    } else if err != nil && !os.IsNotExist(err) {
+        return
+    }
+
+    err = global.Orm.Close()
+    if err != nil {
+        return
+    }
+
+    // journal files belong to the old database, they must not be applied to the restored one.
+    for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+        e := os.Remove(global.PathDB + suffix)
+        if e != nil && !os.IsNotExist(e) {
+            err = e
+            return
+        }
+    }
+
+    err = copyFileAtomic(path, global.PathDB)
+    return
+}
+
+
+/*
+Rebuild the database file to reclaim unused space. before and after are sizes of the database file.
+Vacuum needs free disk space up to twice the size of the database, and it fails if the database is being written.
+*/
+func VacuumDB() (before, after int64, err error) {
+    before, err = DBSize()
+    if err != nil {
+        return
+    }
+
+    _, err = global.Orm.Exec("vacuum")
+    if err != nil {
+        return
+    }
+
+    after, err = DBSize()
+    return
+}
+
+
+// Status of automatic backup, see GetBackupStatus().
+type BackupStatus struct {
+    Interval    uint        `json:"interval"`       // hours, 0 means automatic backup is disabled
+    Keep        uint        `json:"keep"`
+    LastTime    *time.Time  `json:"last_time"`      // time of the last successful backup
+    Path        string      `json:"path"`           // database file of the last successful backup
+    Size        int64       `json:"size"`           // size of Path
+    Error       string      `json:"error"`          // error of the last backup, empty if it succeeded
+    ErrorTime   *time.Time  `json:"error_time"`
+}
+
+
+var backupStatus struct {
+    sync.RWMutex
+    BackupStatus
+}
+
+
+// Get status of automatic backup.
+func GetBackupStatus() BackupStatus {
+    backupStatus.RLock()
+    defer backupStatus.RUnlock()
+    return backupStatus.BackupStatus
+}
+
+
+/*
+Get time stamps of automatic backups in global.PathBackup, sorted from old to new.
+An automatic backup is a pair of files: "feed.auto.<time>.db" and "config.auto.<time>.ini".
+*/
+func autoBackups() (stamps []string, err error) {
+    files, err := ioutil.ReadDir(global.PathBackup)
+    if err != nil {
+        if os.IsNotExist(err) {
+            err = nil
+        }
+        return
+    }
+
+    for _, f := range files {
+        name := f.Name()
+        if f.IsDir() || !strings.HasPrefix(name, "feed.auto.") || !strings.HasSuffix(name, ".db") {
+            continue
+        }
+        stamp := strings.TrimSuffix(strings.TrimPrefix(name, "feed.auto."), ".db")
+        if _, e := time.ParseInLocation(backupTimeFormat, stamp, time.Local); e != nil {
+            continue
+        }
+        stamps = append(stamps, stamp)
+    }
+
+    // time stamps have fixed length, so they could be sorted as strings.
+    sort.Strings(stamps)
+    return
+}
+
+
+func autoBackupDBPath(stamp string) string {
+    return filepath.Join(global.PathBackup, fmt.Sprintf("feed.auto.%s.db", stamp))
+}
+
+
+func autoBackupConfigPath(stamp string) string {
+    return filepath.Join(global.PathBackup, fmt.Sprintf("config.auto.%s.ini", stamp))
+}
+
+
+// Delete old automatic backups, only the newest global.BackupKeep ones are kept.
+func rotateBackups() (err error) {
+    stamps, err := autoBackups()
+    if err != nil {
+        return
+    }
+
+    keep := int(global.BackupKeep)
+    if keep < 1 {
+        keep = 1
+    }
+    if len(stamps) <= keep {
+        return
+    }
+
+    for _, stamp := range stamps[:len(stamps) - keep] {
+        for _, p := range []string{autoBackupDBPath(stamp), autoBackupConfigPath(stamp)} {
+            e := os.Remove(p)
+            if e != nil && !os.IsNotExist(e) {
+                err = e
+                continue
+            }
+            global.Logger.Infof("[BACKUP] Old backup is deleted: %s", p)
+        }
+    }
+    return
+}
+
+
+/*
+Make an automatic backup: copy database and config.ini to global.PathBackup, then delete old backups.
+Status of the backup is saved, see GetBackupStatus().
+*/
+func autoBackup() (err error) {
+    now := time.Now()
+
+    defer func() {
+        backupStatus.Lock()
+        if err != nil {
+            backupStatus.Error = err.Error()
+            backupStatus.ErrorTime = &now
+        } else {
+            backupStatus.Error = ""
+            backupStatus.ErrorTime = nil
+        }
+        backupStatus.Unlock()
+    }()
+
+    err = os.MkdirAll(global.PathBackup, 0755)
+    if err != nil {
+        return
+    }
+
+    stamp := now.Format(backupTimeFormat)
+    dbPath := autoBackupDBPath(stamp)
+    err = BackupDB(dbPath)
+    if err != nil {
+        return
+    }
+
+    info, err := os.Stat(dbPath)
+    if err != nil {
+        return
+    }
+
+    backupStatus.Lock()
+    backupStatus.LastTime = &now
+    backupStatus.Path = dbPath
+    backupStatus.Size = info.Size()
+    backupStatus.Unlock()
+
+    global.Logger.Infof("[BACKUP] Database is saved to %s (%d bytes).", dbPath, info.Size())
+
+    if global.ConfigFile != "" {
+        err = copyFileAtomic(global.ConfigFile, autoBackupConfigPath(stamp))
+        if err != nil {
+            err = fmt.Errorf("Cannot backup config file: %s", err.Error())
+            return
+        }
+    }
+
+    err = rotateBackups()
+    if err != nil {
+        err = fmt.Errorf("Cannot delete old backups: %s", err.Error())
+    }
+    return
+}
+
+
+/*
+Backup database and config.ini every global.BackupInterval hours, and keep the newest global.BackupKeep backups.
+If global.BackupInterval is 0, automatic backup is disabled.
+
+The time of next backup is decided by the newest automatic backup in global.PathBackup, so restarting QReader
+doesn't delay or repeat backups. Backup stops when ctx is canceled, done is closed after it's stopped.
+*/
+func AutoBackup(ctx context.Context) (done <-chan struct{}) {
+    ch := make(chan struct{})
+    done = ch
+
+    interval := time.Duration(global.BackupInterval) * time.Hour
+
+    backupStatus.Lock()
+    backupStatus.Interval = global.BackupInterval
+    backupStatus.Keep = global.BackupKeep
+    backupStatus.Unlock()
+
+    if interval == 0 {
+        global.Logger.Info("[BACKUP] Automatic backup is disabled.")
+        close(ch)
+        return
+    }
+
+    var last time.Time
+    stamps, err := autoBackups()
+    if err != nil {
+        global.Logger.Errorf("[BACKUP] Cannot read backup directory: %s", err.Error())
+    } else if len(stamps) > 0 {
+        stamp := stamps[len(stamps) - 1]
+        last, _ = time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+
+        backupStatus.Lock()
+        backupStatus.LastTime = &last
+        backupStatus.Path = autoBackupDBPath(stamp)
+        if info, e := os.Stat(backupStatus.Path); e == nil {
+            backupStatus.Size = info.Size()
+        }
+        backupStatus.Unlock()
+    }
+
+    go func() {
+        defer close(ch)
+
+        next := last.Add(interval)
+        for {
+            wait := next.Sub(time.Now())
+            if wait < 0 {
+                wait = 0
+            }
+
+            select {
+                case <- ctx.Done():
+                    return
+                case <- time.After(wait):
+            }
+
+            err := autoBackup()
+            if err != nil {
+                global.Logger.Errorf("[BACKUP] Backup failed: %s", err.Error())
+            }
+            next = time.Now().Add(interval)
+        }
+    }()
+
+    return
+}
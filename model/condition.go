@@ -0,0 +1,191 @@
+package model
+
+import "fmt"
+import "regexp"
+import "strconv"
+import "strings"
+import qp "github.com/m3ng9i/go-utils/query-parser"
+
+
+// A value of condition. A value like /.../ is a regular expression, other values are matched as case insensitive substring.
+type conditionValue struct {
+    text    string
+    regexp  *regexp.Regexp
+}
+
+
+func (this *conditionValue) match(s string) bool {
+    if this.regexp != nil {
+        return this.regexp.MatchString(s)
+    }
+    return strings.Contains(strings.ToLower(s), this.text)
+}
+
+
+type conditionNode struct {
+    Key         string
+    Negative    bool
+    values      []conditionValue
+}
+
+
+/*
+Condition for matching items, used by feed filters and rules. It's parsed by qp.Parse(), the syntax is a subset of
+search query (see SearchExpr): a list of terms, without "OR", "AND" and parentheses.
+
+    [-]<key>:<value>[,<value>,...] ...
+
+Supported keys:
+
+    keyword (or no key)     title or content contains the value
+    title                   title contains the value
+    content                 content contains the value
+    author                  author contains the value
+    url                     url contains the value
+    tag                     feed of the item has the tag
+    fid                     Feed.Id of the item
+
+Multiple values of one key are "or" relationship, all the terms are "and" relationship, a key starts with '-'
+means the item should not match any of the values. Other keys of search query (e.g. feed, pubtime, read) are not
+supported. Values are matched case insensitively, a value like /.../ is a regular expression, e.g. title:"/^\[AD\]/".
+*/
+type Condition []conditionNode
+
+
+// Keys of condition which do not need information other than the item itself.
+var itemConditionKeys = []string{"", "keyword", "title", "content", "author", "url"}
+
+// All keys of condition.
+var allConditionKeys = []string{"", "keyword", "title", "content", "author", "url", "tag", "fid"}
+
+
+type ConditionError struct {
+    Node    qp.Node
+    Msg     string
+}
+
+
+func (e *ConditionError) Error() string {
+    return e.Msg
+}
+
+
+/*
+Parse a condition, keys are the supported keys of condition, keys not in it will get a ConditionError.
+err may be qp.InvalidCharError or ConditionError.
+*/
+func ParseCondition(s string, keys []string) (c Condition, err error) {
+
+    nodes, err := qp.Parse(s)
+    if err != nil {
+        return
+    }
+
+    for _, node := range *nodes {
+        key := strings.ToLower(node.Key)
+
+        supported := false
+        for _, k := range keys {
+            if key == k {
+                supported = true
+                break
+            }
+        }
+        if !supported {
+            err = &ConditionError{node, fmt.Sprintf("Do not support key: %s", node.Key)}
+            return
+        }
+
+        if len(node.Values) == 0 {
+            err = &ConditionError{node, fmt.Sprintf("Value of '%s' is empty", node.Key)}
+            return
+        }
+
+        cn := conditionNode{Key: key, Negative: node.Negative}
+
+        for _, value := range node.Values {
+            if len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+                re, e := regexp.Compile(value[1:len(value) - 1])
+                if e != nil {
+                    err = &ConditionError{node, fmt.Sprintf("Regular expression is not correct: %s", e.Error())}
+                    return
+                }
+                cn.values = append(cn.values, conditionValue{regexp: re})
+                continue
+            }
+
+            if key == "fid" {
+                fid, e := strconv.ParseInt(value, 10, 64)
+                if e != nil || fid <= 0 {
+                    err = &ConditionError{node, fmt.Sprintf("Incorrect fid value: %s", value)}
+                    return
+                }
+            }
+            cn.values = append(cn.values, conditionValue{text: strings.ToLower(value)})
+        }
+
+        c = append(c, cn)
+    }
+
+    if len(c) == 0 {
+        err = &ConditionError{Msg: "Condition is empty"}
+    }
+
+    return
+}
+
+
+// Get values of an item that a key of condition should match. tags are tags of the item's feed.
+func conditionFields(key string, item *Item, tags []string) (fields []string) {
+    switch key {
+        case "": fallthrough
+        case "keyword":
+            fields = []string{item.Title, item.Content}
+        case "title":
+            fields = []string{item.Title}
+        case "content":
+            fields = []string{item.Content}
+        case "author":
+            fields = []string{item.Author}
+        case "url":
+            fields = []string{item.Url}
+        case "tag":
+            fields = tags
+        case "fid":
+            fields = []string{strconv.FormatInt(item.Fid, 10)}
+    }
+    return
+}
+
+
+// Check if an item matches the condition. tags are tags of the item's feed.
+func (this Condition) Match(item *Item, tags []string) bool {
+
+    for _, node := range this {
+        fields := conditionFields(node.Key, item, tags)
+
+        found := false
+        LOOP:
+        for _, value := range node.values {
+            for _, field := range fields {
+                var ok bool
+                if value.regexp == nil && (node.Key == "tag" || node.Key == "fid") {
+                    // tags and fid must be equal
+                    ok = strings.ToLower(field) == value.text
+                } else {
+                    ok = value.match(field)
+                }
+                if ok {
+                    found = true
+                    break LOOP
+                }
+            }
+        }
+
+        if found == node.Negative {
+            return false
+        }
+    }
+
+    return true
+}
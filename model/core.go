@@ -14,33 +14,42 @@ type Feed struct {
     FeedUrl     string      `json:"feed_feed_url"       xorm:"notnull unique"`              // url of feed
     Url         string      `json:"feed_url"            xorm:"notnull"`                     // url the feed point to
     Desc        string      `json:"feed_desc"           xorm:"notnull default ''"`          // feed description
-    Type        string      `json:"feed_type"           xorm:"notnull"`                     // feed type: rss or atom
+    Type        string      `json:"feed_type"           xorm:"notnull"`                     // feed type: rss, atom or json
     Interval    *int        `json:"feed_interval"       xorm:"notnull default 0"`           // refresh interval (minute), 0 for default interval. value below zero means not update.
     LastFetch   time.Time   `json:"feed_last_fetch"     xorm:"notnull"`                     // last successful fetch time
     LastFailed  time.Time   `json:"feed_last_failed"    xorm:"notnull"`                     // last failed time for fetching
     LastError   string      `json:"feed_last_error"     xorm:"notnull default ''"`          // last error for fetching
+    FailCount   int         `json:"feed_fail_count"     xorm:"notnull default 0"`           // number of consecutive failed fetches, reset to 0 after a successful fetch
+    Suspended   bool        `json:"feed_suspended"      xorm:"notnull default 0"`           // whether the feed is suspended after too many consecutive failures, Interval is kept
+    ETag        string      `json:"feed_etag"           xorm:"notnull default ''"`          // ETag header of last fetch, used for conditional fetching
+    LastModified string     `json:"feed_last_modified"  xorm:"notnull default ''"`          // Last-Modified header of last fetch, used for conditional fetching
+    MinInterval int         `json:"feed_min_interval"   xorm:"notnull default 0"`           // min refresh interval (minute) declared by the feed (ttl or sy:updatePeriod), 0 for not declared
+    SkipHours   string      `json:"feed_skip_hours"     xorm:"notnull default ''"`          // hours (GMT) the feed should not be fetched, comma separated, e.g. "0,1,2"
+    SkipDays    string      `json:"feed_skip_days"      xorm:"notnull default ''"`          // days the feed should not be fetched, comma separated, e.g. "Saturday,Sunday"
+    RetryAfter  time.Time   `json:"feed_retry_after"    xorm:"notnull"`                     // do not fetch before this time, from http header Retry-After
     MaxUnread   *uint       `json:"feed_max_unread"     xorm:"notnull default 0"`           // max number of unread items. 0 for keep all.
     MaxKeep     *uint       `json:"feed_max_keep"       xorm:"notnull default 0"`           // max number of items to keep. 0 for keep all, greater than 0 for keep n unread items.
-    Filter      *string     `json:"feed_filter"         xorm:"notnull default ''"`          // filter. (not to use now)
+    Filter      *string     `json:"feed_filter"         xorm:"notnull default ''"`          // filter rules, see FilterRule
     UseProxy    int         `json:"feed_use_proxy"      xorm:"notnull default 0"`           // whether to use proxy to fetch feed, 0: try, 1: always, 2: never
     Note        *string     `json:"feed_note"           xorm:"notnull default ''"`          // comments for this feed
+    MarkUpdatedUnread *bool `json:"feed_mark_updated_unread" xorm:"notnull default 0"`      // whether to mark an item unread again when its title or content is changed
 }
 
 
 // Map to table "Item"
 type Item struct {
     Id          int64       `json:"item_id"             xorm:"pk autoincr"`                 // primary key
-    Fid         int64       `json:"item_fid"            xorm:"notnull unique(Fid_Guid)"`    // Feed.Id
+    Fid         int64       `json:"item_fid"            xorm:"notnull unique(Fid_Guid) index(Fid_Url)"` // Feed.Id
     Author      string      `json:"item_author"         xorm:"notnull"`                     // author
-    Url         string      `json:"item_url"            xorm:"notnull unique"`              // url of the item
-    Guid        string      `json:"item_guid"           xorm:"notnull unique(Fid_Guid)"`    // guid of the item
+    Url         string      `json:"item_url"            xorm:"notnull index(Fid_Url)"`      // url of the item, unique in a feed if not empty (a partial index), the same article may be in several feeds
+    Guid        string      `json:"item_guid"           xorm:"notnull unique(Fid_Guid)"`    // guid of the item, or fallbackGuid() if the feed has none
     Title       string      `json:"item_title"          xorm:"notnull"`                     // title
     Content     string      `json:"item_content"        xorm:"notnull"`                     // content
     PubTime     time.Time   `json:"item_pub_time"       xorm:"notnull"`                     // item pubtime
     FetchTime   time.Time   `json:"item_fetch_time"     xorm:"notnull"`                     // item fetch time
     Starred     bool        `json:"item_starred"        xorm:"notnull default 0"`           // whether the item was starred
     Read        bool        `json:"item_read"           xorm:"notnull default 0"`           // whether the item has been read
-    Hash        string      `json:"-"                   xorm:"notnull"`                     // md5sum of content
+    Hash        string      `json:"-"                   xorm:"notnull"`                     // md5sum of content, for detecting changed content
 }
 
 
@@ -52,3 +61,47 @@ type Tag struct {
 }
 
 
+// Map to table "Rule"
+type Rule struct {
+    Id          int64       `json:"rule_id"             xorm:"pk autoincr"`                 // primary key
+    Name        string      `json:"rule_name"           xorm:"notnull default ''"`          // rule name
+    Condition   string      `json:"rule_condition"      xorm:"notnull"`                     // condition for matching items, see Condition
+    Action      string      `json:"rule_action"         xorm:"notnull"`                     // actions for matched items, comma separated: read, star, tag:<name>
+    Enabled     bool        `json:"rule_enabled"        xorm:"notnull default 1"`           // whether the rule is enabled
+}
+
+
+// Map to table "ItemTag", tags of items added by rules or imported with starred articles.
+type ItemTag struct {
+    Id          int64       `xorm:"pk autoincr"`                // primary key
+    Name        string      `xorm:"notnull unique(Name_Iid)"`   // tag name, case insensitive
+    Iid         int64       `xorm:"notnull unique(Name_Iid)"`   // Item.Id
+}
+
+
+// Map to table "ItemRevision", a previous version of an item whose title or content has been changed by the publisher.
+type ItemRevision struct {
+    Id          int64       `json:"revision_id"             xorm:"pk autoincr"`             // primary key
+    Iid         int64       `json:"revision_iid"            xorm:"notnull index"`           // Item.Id
+    Title       string      `json:"revision_title"          xorm:"notnull"`                 // title of this version
+    Content     string      `json:"revision_content"        xorm:"notnull"`                 // content of this version
+    Hash        string      `json:"-"                       xorm:"notnull"`                 // md5sum of content
+    UpdateTime  time.Time   `json:"revision_update_time"    xorm:"notnull"`                 // time this version is replaced by the next version
+}
+
+
+// Map to table "SavedSearch"
+type SavedSearch struct {
+    Id          int64       `json:"saved_search_id"         xorm:"pk autoincr"`             // primary key
+    Name        string      `json:"saved_search_name"       xorm:"notnull"`                 // name of saved search
+    Query       string      `json:"saved_search_query"      xorm:"notnull"`                 // search query, see Search()
+    PageSize    int         `json:"saved_search_page_size"  xorm:"notnull default 0"`       // default number of articles in a page, 0 for client's default
+}
+
+
+// Map to table "SchemaMigration", migrations of database schema have been run, see migration.
+type SchemaMigration struct {
+    Version     int         `xorm:"pk"`                             // migration.Version
+    Name        string      `xorm:"notnull"`                        // migration.Name
+    AppliedTime time.Time   `xorm:"notnull"`                        // time of the migration is run
+}
@@ -0,0 +1,86 @@
+package model
+
+import "encoding/base64"
+import "encoding/json"
+import "errors"
+import "strings"
+
+
+var ErrInvalidCursor        = errors.New("Cursor is not correct.")
+
+
+/*
+Cursor of article list, it points to the last article of a page, and the next page starts after it.
+Unlike offset, a cursor is not affected by articles inserted or deleted while paging.
+
+Keys are values of the columns the list is ordered by (e.g. Title for "orderby:title"), Id is Item.Id which breaks ties.
+For lists ordered by id only, Keys is empty.
+
+The cursor is passed to the client as an opaque string, see String() and parseArticleCursor().
+*/
+type articleCursor struct {
+    Keys    []string    `json:"k,omitempty"`
+    Id      int64       `json:"i"`
+}
+
+
+func (this articleCursor) String() string {
+    b, _ := json.Marshal(this)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+
+// Parse a cursor string. If s is empty, ok is false.
+func parseArticleCursor(s string) (c articleCursor, ok bool, err error) {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return
+    }
+
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        err = ErrInvalidCursor
+        return
+    }
+
+    err = json.Unmarshal(b, &c)
+    if err != nil || c.Id <= 0 {
+        err = ErrInvalidCursor
+        return
+    }
+
+    ok = true
+    return
+}
+
+
+/*
+Get last seen Item.Id of a cursor for article list ordered by id desc. cursor is an optional parameter of
+functions like GetArticleList(), if it's not provided or empty, id is 0.
+*/
+func idCursor(cursor []string) (id int64, err error) {
+    if len(cursor) == 0 {
+        return
+    }
+
+    c, ok, err := parseArticleCursor(cursor[0])
+    if err != nil || !ok {
+        return
+    }
+    if len(c.Keys) > 0 {
+        err = ErrInvalidCursor
+        return
+    }
+
+    id = c.Id
+    return
+}
+
+
+// Cursor of the next page of an article list ordered by id. If the page is not full, there's no next page and cursor is empty.
+func nextIdCursor(articles []*Article, limit int) string {
+    if len(articles) == 0 || len(articles) < limit {
+        return ""
+    }
+    return articleCursor{Id: articles[len(articles) - 1].Item.Id}.String()
+}
@@ -0,0 +1,157 @@
+package model
+
+import "encoding/base64"
+import "fmt"
+import "testing"
+import "time"
+import "github.com/m3ng9i/qreader/global"
+
+
+func TestArticleCursor(t *testing.T) {
+    cursors := []articleCursor{
+        {Id: 1},
+        {Id: 42, Keys: []string{"Title of article", "2026-10-01 00:00:00"}},
+    }
+    for _, c := range cursors {
+        parsed, ok, err := parseArticleCursor(c.String())
+        if err != nil || !ok {
+            t.Errorf("%v: got ok %v, err %v", c, ok, err)
+            continue
+        }
+        if parsed.Id != c.Id || fmt.Sprint(parsed.Keys) != fmt.Sprint(c.Keys) {
+            t.Errorf("got %v, want %v", parsed, c)
+        }
+    }
+
+    _, ok, err := parseArticleCursor(" ")
+    if ok || err != nil {
+        t.Errorf("empty cursor: got ok %v, err %v", ok, err)
+    }
+
+    id, err := idCursor(nil)
+    if id != 0 || err != nil {
+        t.Errorf("no cursor: got id %d, err %v", id, err)
+    }
+
+    id, err = idCursor([]string{articleCursor{Id: 9}.String()})
+    if id != 9 || err != nil {
+        t.Errorf("id cursor: got id %d, err %v, want 9", id, err)
+    }
+}
+
+
+func TestInvalidCursor(t *testing.T) {
+    encode := func(s string) string {
+        return base64.RawURLEncoding.EncodeToString([]byte(s))
+    }
+
+    malformed := []string{
+        "!!!",
+        "eyJpIjo",              // truncated
+        encode("not json"),
+        encode(`{"i":0}`),
+        encode(`{"i":-3}`),
+        encode(`{"i":"3"}`),
+        encode(`{"k":["a"]}`),
+    }
+    for _, s := range malformed {
+        _, _, err := parseArticleCursor(s)
+        if err != ErrInvalidCursor {
+            t.Errorf("%s: got error %v, want ErrInvalidCursor", s, err)
+        }
+        _, err = idCursor([]string{s})
+        if err != ErrInvalidCursor {
+            t.Errorf("%s: idCursor got error %v, want ErrInvalidCursor", s, err)
+        }
+    }
+
+    // a cursor of a list ordered by other columns could not be used for a list ordered by id
+    _, err := idCursor([]string{articleCursor{Id: 3, Keys: []string{"title"}}.String()})
+    if err != ErrInvalidCursor {
+        t.Errorf("cursor with keys: got error %v, want ErrInvalidCursor", err)
+    }
+}
+
+
+// Insert n unread items to a feed, ids of the items are increasing.
+func insertTestItems(t *testing.T, fid int64, start, n int) {
+    for i := start; i < start + n; i++ {
+        item := &Item{
+            Fid:        fid,
+            Url:        fmt.Sprintf("http://example.com/post/%d", i),
+            Guid:       fmt.Sprintf("guid-%d", i),
+            Title:      fmt.Sprintf("Post %d", i),
+            Content:    "Content",
+            PubTime:    time.Now(),
+            FetchTime:  time.Now(),
+            Hash:       fmt.Sprintf("hash-%d", i),
+        }
+        _, err := global.Orm.Insert(item)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+}
+
+
+// Articles inserted while paging with a cursor should not cause duplicates or gaps.
+func TestIdCursorPaging(t *testing.T) {
+    defer openTestDB(t)()
+
+    feed, _ := testFeedWithoutGuid(nil, nil)
+    fid, _, _, err := Subscribe(feed, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    insertTestItems(t, fid, 0, 7)
+
+    var existing []*Item
+    err = global.Orm.Cols("Id").Where("Fid = ?", fid).Desc("Id").Find(&existing)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    seen := make(map[int64]bool)
+    var ids []int64
+    cursor := ""
+    for page := 0; ; page++ {
+        if page > len(existing) {
+            t.Fatal("too many pages")
+        }
+
+        list, err := GetArticleList(3, 0, cursor)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, a := range list.Articles {
+            if seen[a.Item.Id] {
+                t.Errorf("page %d: article %d is duplicated", page, a.Item.Id)
+            }
+            seen[a.Item.Id] = true
+            ids = append(ids, a.Item.Id)
+        }
+
+        if list.NextCursor == "" {
+            break
+        }
+        cursor = list.NextCursor
+
+        // new articles are inserted before the next page is fetched
+        insertTestItems(t, fid, 100 + page * 10, 2)
+    }
+
+    if len(ids) != len(existing) {
+        t.Fatalf("got %d articles %v, want %d", len(ids), ids, len(existing))
+    }
+    for i, item := range existing {
+        if ids[i] != item.Id {
+            t.Fatalf("got articles %v, want them in order of id desc without gaps", ids)
+        }
+    }
+
+    _, err = GetArticleList(3, 0, "!!!")
+    if err != ErrInvalidCursor {
+        t.Errorf("malformed cursor: got error %v, want ErrInvalidCursor", err)
+    }
+}
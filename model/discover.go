@@ -0,0 +1,230 @@
+package model
+
+import "context"
+import "html"
+import "io"
+import "io/ioutil"
+import "net/http"
+import "net/url"
+import "regexp"
+import "strings"
+import "sync"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Max size of a web page read for discovering feeds.
+const maxDiscoverPageSize = 5 << 20
+
+
+// Common paths of feeds, they are tried if a web page is not a feed.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml"}
+
+
+// Mime types of feeds in <link rel="alternate" type="...">, and the feed type.
+var feedMimeTypes = map[string]string {
+    "application/rss+xml":      "rss",
+    "application/atom+xml":     "atom",
+    "application/feed+json":    "json",
+}
+
+
+type FeedCandidateSource string
+const CANDIDATE_URL     FeedCandidateSource = "url"     // the url itself is a feed
+const CANDIDATE_LINK    FeedCandidateSource = "link"    // declared by <link rel="alternate"> in the web page, not fetched
+const CANDIDATE_PATH    FeedCandidateSource = "path"    // found at a common path of the site, see commonFeedPaths
+
+
+// A feed found by DiscoverFeed().
+type FeedCandidate struct {
+    Url         string                  `json:"url"`
+    Title       string                  `json:"title"`
+    Type        string                  `json:"type"`           // rss, atom or json
+    Source      FeedCandidateSource     `json:"source"`
+    Subscribed  bool                    `json:"subscribed"`     // whether the feed is already subscribed
+}
+
+
+var linkTagRe   = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+var baseTagRe   = regexp.MustCompile(`(?is)<base\b[^>]*>`)
+var attrRe      = regexp.MustCompile(`(?is)([a-z][a-z0-9_:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+
+
+// Get attributes of a html tag, names are in lower case.
+func tagAttrs(tag string) map[string]string {
+    attrs := make(map[string]string)
+    for _, m := range attrRe.FindAllStringSubmatch(tag, -1) {
+        name := strings.ToLower(m[1])
+        if _, ok := attrs[name]; ok {
+            continue
+        }
+        attrs[name] = html.UnescapeString(m[2] + m[3] + m[4])
+    }
+    return attrs
+}
+
+
+/*
+Find feeds declared in a web page by <link rel="alternate" type="application/rss+xml|atom+xml|feed+json" href="...">.
+Relative urls are resolved against pageUrl or <base href="...">.
+*/
+func parseFeedLinks(page []byte, pageUrl *url.URL) (candidates []*FeedCandidate) {
+    base := pageUrl
+    if tag := baseTagRe.Find(page); tag != nil {
+        if href, ok := tagAttrs(string(tag))["href"]; ok {
+            if u, err := pageUrl.Parse(strings.TrimSpace(href)); err == nil {
+                base = u
+            }
+        }
+    }
+
+    for _, tag := range linkTagRe.FindAll(page, -1) {
+        attrs := tagAttrs(string(tag))
+
+        alternate := false
+        for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+            if rel == "alternate" {
+                alternate = true
+                break
+            }
+        }
+        if !alternate {
+            continue
+        }
+
+        // type may contain parameters, e.g. "application/rss+xml; charset=utf-8"
+        mime := strings.ToLower(strings.TrimSpace(strings.SplitN(attrs["type"], ";", 2)[0]))
+        feedType, ok := feedMimeTypes[mime]
+        if !ok {
+            continue
+        }
+
+        href := strings.TrimSpace(attrs["href"])
+        if href == "" {
+            continue
+        }
+        u, err := base.Parse(href)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+            continue
+        }
+
+        candidates = append(candidates, &FeedCandidate{
+            Url:    u.String(),
+            Title:  strings.TrimSpace(attrs["title"]),
+            Type:   feedType,
+            Source: CANDIDATE_LINK,
+        })
+    }
+    return
+}
+
+
+// Get a web page with client, finalUrl is the url after redirects.
+func getPage(ctx context.Context, pageUrl string, client *http.Client) (page []byte, finalUrl *url.URL, err error) {
+    resp, err := httpGet(ctx, pageUrl, client, "", "")
+    if err != nil {
+        err = &FetchError{Url: pageUrl, Err: err}
+        return
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        err = &FetchError{Url: pageUrl, StatusCode: resp.StatusCode}
+        return
+    }
+
+    page, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxDiscoverPageSize))
+    if err != nil {
+        err = &FetchError{Url: pageUrl, StatusCode: resp.StatusCode, Err: err}
+        return
+    }
+    finalUrl = resp.Request.URL
+    return
+}
+
+
+// Get a web page normally or behind a proxy, the same as fetching feeds.
+func fetchPage(ctx context.Context, pageUrl string) (page []byte, finalUrl *url.URL, err error) {
+    if global.UseProxy == global.PROXY_ALWAYS {
+        return getPage(ctx, pageUrl, global.Socks5Client)
+    }
+
+    page, finalUrl, err = getPage(ctx, pageUrl, global.NormalClient)
+    if err != nil && ctx.Err() == nil && global.UseProxy == global.PROXY_TRY {
+        page, finalUrl, err = getPage(ctx, pageUrl, global.Socks5Client)
+    }
+    return
+}
+
+
+/*
+Discover feeds of a url. If the url is a feed, it's the only candidate. Otherwise the url is treated as a web page:
+feeds declared by <link rel="alternate"> in the page are returned, and common paths of the site (see commonFeedPaths)
+are fetched, those which are feeds are returned too. candidates is empty if no feed is found.
+*/
+func DiscoverFeed(pageUrl string) (candidates []*FeedCandidate, err error) {
+    u, err := url.Parse(strings.TrimSpace(pageUrl))
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        err = ErrNotHttpUrl
+        return
+    }
+
+    ctx := context.Background()
+
+    page, finalUrl, err := fetchPage(ctx, u.String())
+    if err != nil {
+        global.Logger.Errorf("[FETCH] Discover feeds of '%s': %s", u.String(), err.Error())
+        return
+    }
+
+    if fd, e := parseFeedDoc(page, "", u.String()); e == nil {
+        candidates = append(candidates, &FeedCandidate{Url: u.String(), Title: fd.Title, Type: fd.Type, Source: CANDIDATE_URL})
+    } else {
+        candidates = parseFeedLinks(page, finalUrl)
+
+        found := make(map[string]bool)
+        for _, c := range candidates {
+            found[c.Url] = true
+        }
+
+        // try common paths at the same time
+        probed := make([]*FeedCandidate, len(commonFeedPaths))
+        var wg sync.WaitGroup
+        for i, path := range commonFeedPaths {
+            feedUrl := (&url.URL{Scheme: finalUrl.Scheme, Host: finalUrl.Host, Path: path}).String()
+            if found[feedUrl] {
+                continue
+            }
+
+            wg.Add(1)
+            go func(i int, feedUrl string) {
+                defer wg.Done()
+                doc, _, e := fetchPage(ctx, feedUrl)
+                if e != nil {
+                    return
+                }
+                fd, e := parseFeedDoc(doc, "", feedUrl)
+                if e != nil {
+                    return
+                }
+                probed[i] = &FeedCandidate{Url: feedUrl, Title: fd.Title, Type: fd.Type, Source: CANDIDATE_PATH}
+            }(i, feedUrl)
+        }
+        wg.Wait()
+
+        for _, c := range probed {
+            if c != nil {
+                candidates = append(candidates, c)
+            }
+        }
+    }
+
+    for _, c := range candidates {
+        c.Subscribed, err = IsSubscribed(c.Url)
+        if err != nil {
+            return
+        }
+    }
+
+    global.Logger.Infof("[FETCH] Discover feeds of '%s': %d found", u.String(), len(candidates))
+    return
+}
@@ -1,7 +1,65 @@
 package model
 
 import "errors"
+import "fmt"
+import "strings"
+import "time"
+import "github.com/m3ng9i/feedreader"
 
 var ErrFeedNotFound         = errors.New("Feed not found.")
 var ErrFeedHasNoItems       = errors.New("Feed has no items.")
 var ErrFeedCannotBeDeleted  = errors.New("Feed has starred items, cannot be deleted.")
+var ErrNotHttpUrl           = errors.New("Url is not a http or https url.")
+
+
+// Error occurs when fetching a feed: a network error, or http status code is not 200 or 304.
+type FetchError struct {
+    Url         string
+    StatusCode  int         // http status code, 0 if no response is received
+    RetryAfter  time.Time   // from http header Retry-After of status 429 or 503, zero if not provided
+    Err         error
+}
+
+
+func (e *FetchError) Error() string {
+    if e.Err != nil {
+        return fmt.Sprintf("Cannot fetch '%s': %s", e.Url, e.Err.Error())
+    }
+    if !e.RetryAfter.IsZero() {
+        return fmt.Sprintf("Cannot fetch '%s': http status code: %d, retry after %s", e.Url, e.StatusCode,
+            e.RetryAfter.Format("2006-01-02 15:04:05"))
+    }
+    return fmt.Sprintf("Cannot fetch '%s': http status code: %d", e.Url, e.StatusCode)
+}
+
+
+/*
+Error occurs when parsing a feed document which is not parsed by feedreader, Format is the dialect of the document,
+e.g. "JSON Feed", "RSS 1.0".
+*/
+type FeedParseError struct {
+    Url         string
+    Format      string
+    Err         error
+}
+
+
+func (e *FeedParseError) Error() string {
+    return fmt.Sprintf("Cannot parse %s '%s': %s", e.Format, e.Url, e.Err.Error())
+}
+
+
+// Check if err occurs when parsing a feed document: feedreader.ParseError or FeedParseError.
+func IsParseError(err error) bool {
+    switch err.(type) {
+        case *feedreader.ParseError, *FeedParseError:
+            return true
+    }
+    return false
+}
+
+
+// Check if err is caused by a unique index of sqlite, e.g. inserting an item which already exists.
+func isUniqueError(err error) bool {
+    return strings.HasPrefix(err.Error(), "UNIQUE constraint failed")
+}
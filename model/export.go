@@ -0,0 +1,455 @@
+package model
+
+import "crypto/md5"
+import "encoding/json"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "strings"
+import "time"
+import "github.com/go-xorm/core"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Version of the format of exported data, it's increased when the format is changed incompatibly.
+const ExportFormatVersion = 1
+
+
+type ExportRecordType string
+const EXPORT_HEADER     ExportRecordType = "header"
+const EXPORT_FEED       ExportRecordType = "feed"
+const EXPORT_ITEM       ExportRecordType = "item"
+const EXPORT_TAG        ExportRecordType = "tag"
+const EXPORT_TRAILER    ExportRecordType = "trailer"
+
+
+/*
+Exported data is in JSON Lines format: one record per line, like {"type":"feed","data":{...}}.
+
+The first record is the header, followed by feeds, items and tags, the last record is the trailer. Data of a feed record
+is a Feed, data of an item record is an Item, data of a tag record is an ExportTag and data of the trailer is
+an ExportResult: numbers of the records, so truncated data could be detected. Ids in the data are ids in the source
+database, they are used to find the feed an item or a tag belongs to, and will be remapped when importing.
+*/
+type exportRecord struct {
+    Type        ExportRecordType    `json:"type"`
+    Data        interface{}         `json:"data"`
+}
+
+
+// Record read from exported data, Data is decoded according to Type.
+type importRecord struct {
+    Type        ExportRecordType    `json:"type"`
+    Data        json.RawMessage     `json:"data"`
+}
+
+
+// Header of exported data.
+type ExportHeader struct {
+    Format          string      `json:"format"`             // always "qreader"
+    Version         int         `json:"version"`            // ExportFormatVersion
+    SchemaVersion   int         `json:"schema_version"`     // schema version of the source database
+    Time            time.Time   `json:"time"`               // time of exporting
+}
+
+
+// A row of table Tag in exported data.
+type ExportTag struct {
+    Name        string      `json:"tag_name"`
+    Fid         int64       `json:"tag_fid"`
+}
+
+
+// Number of rows exported, it's also the data of the trailer record.
+type ExportResult struct {
+    Feeds       int64       `json:"feeds"`
+    Items       int64       `json:"items"`
+    Tags        int64       `json:"tags"`
+}
+
+
+/*
+Export all the feeds, items (including read and starred status) and tags to w in JSON Lines format, see exportRecord.
+
+Rows are written one by one, so the whole data is never held in memory. They are read from a snapshot of the
+database made by BackupDB(), so the exported data is consistent, and writing to a slow client does not keep the
+database locked: feeds could be updated while exporting.
+*/
+func ExportData(w io.Writer) (result ExportResult, err error) {
+    dir, err := ioutil.TempDir(filepath.Dir(global.PathDB), "export")
+    if err != nil {
+        return
+    }
+    defer os.RemoveAll(dir)
+
+    snapshot := filepath.Join(dir, "feed.db")
+    err = BackupDB(snapshot)
+    if err != nil {
+        return
+    }
+
+    orm, err := xorm.NewEngine("sqlite3", snapshot)
+    if err != nil {
+        return
+    }
+    defer orm.Close()
+    orm.SetMapper(core.SameMapper{})
+
+    version, err := schemaVersion(orm.DB().DB)
+    if err != nil {
+        return
+    }
+
+    session := orm.NewSession()
+    defer session.Close()
+
+    enc := json.NewEncoder(w)
+
+    err = enc.Encode(exportRecord{EXPORT_HEADER, ExportHeader{
+        Format:         "qreader",
+        Version:        ExportFormatVersion,
+        SchemaVersion:  version,
+        Time:           time.Now(),
+    }})
+    if err != nil {
+        return
+    }
+
+    err = session.Asc("Id").Iterate(new(Feed), func(i int, bean interface{}) error {
+        result.Feeds++
+        return enc.Encode(exportRecord{EXPORT_FEED, bean.(*Feed)})
+    })
+    if err != nil {
+        return
+    }
+
+    err = session.Asc("Id").Iterate(new(Item), func(i int, bean interface{}) error {
+        result.Items++
+        return enc.Encode(exportRecord{EXPORT_ITEM, bean.(*Item)})
+    })
+    if err != nil {
+        return
+    }
+
+    err = session.Asc("Id").Iterate(new(Tag), func(i int, bean interface{}) error {
+        tag := bean.(*Tag)
+        result.Tags++
+        return enc.Encode(exportRecord{EXPORT_TAG, ExportTag{Name: tag.Name, Fid: tag.Fid}})
+    })
+    if err != nil {
+        return
+    }
+
+    err = enc.Encode(exportRecord{EXPORT_TRAILER, result})
+    return
+}
+
+
+// Error in the data to import, Record is the number of the record (line number for JSON Lines), starting from 1.
+type ImportDataError struct {
+    Record      int
+    Msg         string
+}
+
+
+func (e *ImportDataError) Error() string {
+    return fmt.Sprintf("Record %d: %s", e.Record, e.Msg)
+}
+
+
+// Report of importing data.
+type ImportResult struct {
+    FeedsAdded      int64       `json:"feeds_added"`
+    FeedsExisting   int64       `json:"feeds_existing"`     // feeds already subscribed, their settings are not changed
+    ItemsAdded      int64       `json:"items_added"`
+    ItemsMerged     int64       `json:"items_merged"`       // items already exist, read and starred status are merged
+    ItemsSkipped    int64       `json:"items_skipped"`      // items whose feed is not in the data
+    TagsAdded       int64       `json:"tags_added"`
+}
+
+
+// Insert a feed of imported data if it's not subscribed. id is Feed.Id in the database.
+func importFeed(session *xorm.Session, feed *Feed) (id int64, added bool, err error) {
+    existing := new(Feed)
+    ok, err := session.Cols("Id").Where("FeedUrl = ?", feed.FeedUrl).Get(existing)
+    if err != nil {
+        return
+    }
+    if ok {
+        id = existing.Id
+        return
+    }
+
+    // Alias, Interval etc. cannot be null.
+    empty := ""
+    var zeroInt int = 0
+    var zeroUint uint = 0
+    if feed.Alias == nil {
+        feed.Alias = &empty
+    }
+    if feed.Note == nil {
+        feed.Note = &empty
+    }
+    if feed.Filter == nil {
+        feed.Filter = &empty
+    } else if _, e := ParseFilter(*feed.Filter); e != nil {
+        feed.Filter = &empty
+    }
+    if feed.Interval == nil {
+        feed.Interval = &zeroInt
+    }
+    if feed.MaxUnread == nil {
+        feed.MaxUnread = &zeroUint
+    }
+    if feed.MaxKeep == nil {
+        feed.MaxKeep = &zeroUint
+    }
+    if feed.MarkUpdatedUnread == nil {
+        no := false
+        feed.MarkUpdatedUnread = &no
+    }
+
+    feed.Id = 0
+    _, err = session.Insert(feed)
+    if err != nil {
+        return
+    }
+
+    id = feed.Id
+    added = true
+    return
+}
+
+
+/*
+Insert an item of imported data. If the item already exists (same Guid or same Url in the feed), it's read and starred
+status are merged: it will be read or starred if it's read or starred in either the database or the imported data.
+An item without url is matched by Guid only.
+*/
+func importItem(session *xorm.Session, item *Item) (added bool, err error) {
+    existing := new(Item)
+    var ok bool
+    if item.Url == "" {
+        ok, err = session.Cols("Id", "Read", "Starred").Where("Fid = ? and Guid = ?", item.Fid, item.Guid).Get(existing)
+    } else {
+        ok, err = session.Cols("Id", "Read", "Starred").Where("Fid = ? and (Guid = ? or Url = ?)",
+            item.Fid, item.Guid, item.Url).Get(existing)
+    }
+    if err != nil {
+        return
+    }
+
+    if ok {
+        if (item.Read && !existing.Read) || (item.Starred && !existing.Starred) {
+            _, err = session.Exec("update Item set Read = ?, Starred = ? where Id = ?",
+                item.Read || existing.Read, item.Starred || existing.Starred, existing.Id)
+        }
+        return
+    }
+
+    h := md5.New()
+    fmt.Fprint(h, item.Content)
+    item.Hash = fmt.Sprintf("%x", h.Sum(nil))
+
+    item.Id = 0
+    _, err = session.Insert(item)
+    if err != nil {
+        return
+    }
+    added = true
+    return
+}
+
+
+// Insert a tag of imported data if the feed does not have it.
+func importTag(session *xorm.Session, name string, fid int64) (added bool, err error) {
+    name = strings.TrimSpace(name)
+    if name == "" {
+        return
+    }
+
+    total, err := session.Where("Fid = ? and lower(Name) = lower(?)", fid, name).Count(&Tag{})
+    if err != nil || total > 0 {
+        return
+    }
+
+    _, err = session.Insert(&Tag{Name: name, Fid: fid})
+    if err != nil {
+        return
+    }
+    added = true
+    return
+}
+
+
+/*
+Import data exported by ExportData() and merge it into the database.
+
+Feeds are matched by Feed.FeedUrl, items by Item.Fid + Item.Guid or Item.Fid + Item.Url (the unique indexes),
+items without url by Item.Fid + Item.Guid only, so importing the same data again does not create duplicates.
+Feed ids in the data are remapped to ids in the database. Filters and global rules are not applied to imported items,
+the data is restored as it is.
+All the data is imported in one transaction, if an error occurs, nothing is imported.
+If the data is not correct, err is *ImportDataError. Data without the trailer, or whose numbers of records don't match
+the trailer, is truncated and not imported.
+*/
+func ImportData(r io.Reader) (result ImportResult, err error) {
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+
+    // feed id in the data => feed id in the database
+    fids := make(map[int64]int64)
+
+    // numbers of records read, they are checked with the trailer
+    var records ExportResult
+    trailer := false
+
+    dec := json.NewDecoder(r)
+    for n := 1; ; n++ {
+        var record importRecord
+        err = dec.Decode(&record)
+        if err == io.EOF {
+            if n == 1 {
+                err = &ImportDataError{n, "Data is empty."}
+                break
+            }
+            err = nil
+            if !trailer {
+                err = &ImportDataError{n, "Trailer is not found, data is truncated."}
+            }
+            break
+        }
+        if err != nil {
+            err = &ImportDataError{n, err.Error()}
+            break
+        }
+
+        if trailer {
+            err = &ImportDataError{n, "Records after the trailer."}
+            break
+        }
+
+        if n == 1 {
+            var header ExportHeader
+            if record.Type != EXPORT_HEADER || json.Unmarshal(record.Data, &header) != nil || header.Format != "qreader" {
+                err = &ImportDataError{n, "Header is not found, data is not exported by QReader."}
+                break
+            }
+            if header.Version > ExportFormatVersion {
+                err = &ImportDataError{n, fmt.Sprintf("Format version %d is not supported.", header.Version)}
+                break
+            }
+            continue
+        }
+
+        switch record.Type {
+            case EXPORT_FEED:
+                records.Feeds++
+                var feed Feed
+                err = json.Unmarshal(record.Data, &feed)
+                if err != nil || feed.FeedUrl == "" {
+                    err = &ImportDataError{n, "Feed is not correct."}
+                    break
+                }
+
+                oldId := feed.Id
+                var added bool
+                fids[oldId], added, err = importFeed(session, &feed)
+                if err == nil {
+                    if added {
+                        result.FeedsAdded++
+                    } else {
+                        result.FeedsExisting++
+                    }
+                }
+
+            case EXPORT_ITEM:
+                records.Items++
+                var item Item
+                err = json.Unmarshal(record.Data, &item)
+                if err != nil || item.Guid == "" {
+                    err = &ImportDataError{n, "Item is not correct."}
+                    break
+                }
+
+                fid, ok := fids[item.Fid]
+                if !ok {
+                    result.ItemsSkipped++
+                    break
+                }
+                item.Fid = fid
+
+                var added bool
+                added, err = importItem(session, &item)
+                if err == nil {
+                    if added {
+                        result.ItemsAdded++
+                    } else {
+                        result.ItemsMerged++
+                    }
+                }
+
+            case EXPORT_TAG:
+                records.Tags++
+                var tag ExportTag
+                err = json.Unmarshal(record.Data, &tag)
+                if err != nil {
+                    err = &ImportDataError{n, "Tag is not correct."}
+                    break
+                }
+
+                fid, ok := fids[tag.Fid]
+                if !ok {
+                    break
+                }
+
+                var added bool
+                added, err = importTag(session, tag.Name, fid)
+                if added {
+                    result.TagsAdded++
+                }
+
+            case EXPORT_TRAILER:
+                var numbers ExportResult
+                err = json.Unmarshal(record.Data, &numbers)
+                if err != nil {
+                    err = &ImportDataError{n, "Trailer is not correct."}
+                    break
+                }
+                if numbers != records {
+                    err = &ImportDataError{n, fmt.Sprintf("%d feeds, %d items and %d tags are expected, but %d, %d and %d are read.",
+                        numbers.Feeds, numbers.Items, numbers.Tags, records.Feeds, records.Items, records.Tags)}
+                    break
+                }
+                trailer = true
+
+            default:
+                err = &ImportDataError{n, fmt.Sprintf("Unknown record type '%s'.", record.Type)}
+        }
+
+        if err != nil {
+            break
+        }
+    }
+
+    if err != nil {
+        session.Rollback()
+        result = ImportResult{}
+        return
+    }
+
+    err = session.Commit()
+    if err != nil {
+        session.Rollback()
+        result = ImportResult{}
+    }
+    return
+}
@@ -0,0 +1,82 @@
+package model
+
+import "bytes"
+import "strings"
+import "testing"
+
+
+// Data without the trailer, or whose numbers of records don't match the trailer, should be rejected.
+func TestImportDataTruncated(t *testing.T) {
+    defer openTestDB(t)()
+
+    feed, items := testFeedWithoutGuid([]string{"First", "Second"}, []string{"First content", "Second content"})
+    items[1].Url = "http://example.com/post/2"
+    _, _, _, err := Subscribe(feed, items)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    n, err := ExportData(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n.Feeds != 1 || n.Items != 2 {
+        t.Fatalf("export: got %d feeds and %d items, want 1 and 2", n.Feeds, n.Items)
+    }
+
+    lines := strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+    if !strings.Contains(lines[len(lines) - 1], `"type":"trailer"`) {
+        t.Fatalf("the last record is not the trailer: %s", lines[len(lines) - 1])
+    }
+
+    truncated := []string{
+        strings.Join(lines[:len(lines) - 1], ""),                                   // without the trailer
+        lines[0] + lines[1] + lines[len(lines) - 1] + "\n",                         // items are lost
+    }
+    for i, data := range truncated {
+        _, err = ImportData(strings.NewReader(data))
+        if _, ok := err.(*ImportDataError); !ok {
+            t.Errorf("truncated data %d: got error %v, want ImportDataError", i, err)
+        }
+    }
+
+    result, err := ImportData(bytes.NewReader(buf.Bytes()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.FeedsExisting != 1 || result.ItemsMerged != 2 {
+        t.Errorf("import: got %d existing feeds and %d merged items, want 1 and 2", result.FeedsExisting, result.ItemsMerged)
+    }
+}
+
+
+// Items without link are exported with an empty url, they should be imported and matched by guid.
+func TestImportDataItemWithoutUrl(t *testing.T) {
+    defer openTestDB(t)()
+
+    feed, items := testFeedWithoutGuid([]string{"First", "Second"}, []string{"First content", "Second content"})
+    items[0].Url = ""
+    items[1].Url = ""
+    _, _, _, err := Subscribe(feed, items)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var buf bytes.Buffer
+    n, err := ExportData(&buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n.Items != 2 {
+        t.Fatalf("export: got %d items, want 2", n.Items)
+    }
+
+    result, err := ImportData(bytes.NewReader(buf.Bytes()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result.ItemsAdded != 0 || result.ItemsMerged != 2 {
+        t.Errorf("import: got %d added and %d merged items, want 0 and 2", result.ItemsAdded, result.ItemsMerged)
+    }
+}
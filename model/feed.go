@@ -2,6 +2,7 @@ package model
 
 import "fmt"
 import "strings"
+import "time"
 import dbsql "database/sql"
 import "github.com/go-xorm/xorm"
 import "github.com/m3ng9i/qreader/global"
@@ -60,14 +61,14 @@ func GetArticleNumber() (number *ArticleNumber, err error){
 // Get all data in table Feed.
 func GetFeedList() (feedlist []*Feed, err error) {
 
-    feed := new(Feed)
-    rows, err := global.Orm.Rows(feed)
+    rows, err := global.Orm.Rows(new(Feed))
     if err != nil {
         return
     }
     defer rows.Close()
 
     for rows.Next() {
+        feed := new(Feed)
         err = rows.Scan(feed)
         if err != nil {
             return
@@ -220,12 +221,42 @@ func getTagWithFeedIds(session *xorm.Session) (result TagWithFeedIds, err error)
 type Article struct {
     Item `xorm:"extends"`
     Feed `xorm:"extends"`
+    Excerpt string `json:"item_excerpt,omitempty" xorm:"-"` // plain text excerpt of content, only for article lists, see LoadExcerpts()
 }
 
 
 type ArticleList struct {
     Articles []*Article `xorm:"extends"`
     Number int64 // amount of all articles
+    NextCursor string `json:"next_cursor"` // cursor of the next page, empty if there's no next page
+}
+
+
+/*
+Columns selected for article lists, Item.Content is not included. Feed.* is placed as the last column to fit Article structure.
+
+Select articles with an explicit column list instead of Omit("Item.Content"), which doesn't work on joined tables,
+see https://github.com/go-xorm/xorm/issues/222
+*/
+const articleListColumns = `Item.Id, Item.Fid, Item.Author, Item.Url, Item.Guid, Item.Title, Item.PubTime,
+                Item.FetchTime, Item.Starred, Item.Read, Item.Hash, Feed.*`
+
+
+/*
+Find articles ordered by Item.Id desc. where is the condition of Item and Feed, args are bound parameters of where.
+If lastId is greater than 0, articles after it are returned and offset is ignored, see idCursor().
+*/
+func findArticlesById(session *xorm.Session, where string, args []interface{}, lastId int64, limit, offset int) (articles []*Article, err error) {
+    if lastId > 0 {
+        where += " and Item.Id < ?"
+        args = append(args, lastId)
+        offset = 0
+    }
+
+    sql := fmt.Sprintf("select %s from Item inner join Feed on Item.Fid=Feed.Id where %s order by Item.Id desc limit %d, %d",
+        articleListColumns, where, offset, limit)
+    err = session.Sql(sql, args...).Find(&articles)
+    return
 }
 
 
@@ -246,17 +277,27 @@ func GetRandomArticleList(limit int) (list ArticleList, err error) {
         return
     }
 
-    // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-    // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-    err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").And("Item.Read=0").OrderBy("RANDOM()").Limit(limit).Find(&list.Articles)
+    sql := fmt.Sprintf("select %s from Item inner join Feed on Item.Fid=Feed.Id where Item.Read=0 order by random() limit %d",
+        articleListColumns, limit)
+    err = session.Sql(sql).Find(&list.Articles)
 
     session.Commit()
     return
 }
 
 
-// Get unread article list, order by id desc.
-func GetArticleList(limit, offset int) (list ArticleList, err error) {
+/*
+Get unread article list, order by id desc.
+
+cursor is optional, it's the NextCursor of the previous page. If cursor is provided, offset is ignored.
+It's the same for GetStarredArticleList(), GetArticleListByFid() and GetArticleListByTag().
+*/
+func GetArticleList(limit, offset int, cursor ...string) (list ArticleList, err error) {
+
+    lastId, err := idCursor(cursor)
+    if err != nil {
+        return
+    }
 
     session := global.Orm.NewSession()
     defer session.Close()
@@ -272,17 +313,22 @@ func GetArticleList(limit, offset int) (list ArticleList, err error) {
         return
     }
 
-    // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-    // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-    err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").And("Item.Read=0").Desc("Id").Limit(limit, offset).Find(&list.Articles)
+    list.Articles, err = findArticlesById(session, "Item.Read=0", nil, lastId, limit, offset)
+    list.NextCursor = nextIdCursor(list.Articles, limit)
 
     session.Commit()
     return
 }
 
 
-// Get starred article lsit.
-func GetStarredArticleList(limit, offset int) (list ArticleList, err error) {
+// Get starred article lsit, order by id desc.
+func GetStarredArticleList(limit, offset int, cursor ...string) (list ArticleList, err error) {
+
+    lastId, err := idCursor(cursor)
+    if err != nil {
+        return
+    }
+
     session := global.Orm.NewSession()
     defer session.Close()
 
@@ -297,9 +343,8 @@ func GetStarredArticleList(limit, offset int) (list ArticleList, err error) {
         return
     }
 
-    // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-    // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-    err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").And("Item.Starred=1").Desc("Id").Limit(limit, offset).Find(&list.Articles)
+    list.Articles, err = findArticlesById(session, "Item.Starred=1", nil, lastId, limit, offset)
+    list.NextCursor = nextIdCursor(list.Articles, limit)
 
     session.Commit()
     return
@@ -307,7 +352,12 @@ func GetStarredArticleList(limit, offset int) (list ArticleList, err error) {
 
 
 // Get unread article list by fid, order by id desc.
-func GetArticleListByFid(fid int64, limit, offset int) (list ArticleList, err error) {
+func GetArticleListByFid(fid int64, limit, offset int, cursor ...string) (list ArticleList, err error) {
+
+    lastId, err := idCursor(cursor)
+    if err != nil {
+        return
+    }
 
     session := global.Orm.NewSession()
     defer session.Close()
@@ -324,10 +374,8 @@ func GetArticleListByFid(fid int64, limit, offset int) (list ArticleList, err er
         return
     }
 
-    // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-    // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-    err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").
-            And(fmt.Sprintf("Item.Fid=%d", fid)).And("Item.Read=0").Desc("Id").Limit(limit, offset).Find(&list.Articles)
+    list.Articles, err = findArticlesById(session, "Item.Fid=? and Item.Read=0", []interface{}{fid}, lastId, limit, offset)
+    list.NextCursor = nextIdCursor(list.Articles, limit)
 
     session.Commit()
     return
@@ -335,7 +383,13 @@ func GetArticleListByFid(fid int64, limit, offset int) (list ArticleList, err er
 
 
 // Get unread article list by tag name, order by id desc.
-func GetArticleListByTag(tag string, limit, offset int) (list ArticleList, err error) {
+func GetArticleListByTag(tag string, limit, offset int, cursor ...string) (list ArticleList, err error) {
+
+    lastId, err := idCursor(cursor)
+    if err != nil {
+        return
+    }
+
     session := global.Orm.NewSession()
     defer session.Close()
 
@@ -362,12 +416,15 @@ func GetArticleListByTag(tag string, limit, offset int) (list ArticleList, err e
         return
     }
 
-    // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-    // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-    err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").
-            In("Item.Fid", fids).And("Item.Read=0").Desc("Id").Limit(limit, offset).Find(&list.Articles)
+    var args []interface{}
+    for _, fid := range fids {
+        args = append(args, fid)
+    }
+    where := fmt.Sprintf("Item.Fid in (%s) and Item.Read=0", strings.TrimSuffix(strings.Repeat("?,", len(fids)), ","))
+
+    list.Articles, err = findArticlesById(session, where, args, lastId, limit, offset)
+    list.NextCursor = nextIdCursor(list.Articles, limit)
 
-    //session.Table
     session.Commit()
     return
 }
@@ -407,10 +464,9 @@ func GetRelatedArticles(id int64, n int) (list []*Article, err error) {
 
     // 2. Get articles which Fid = fid
     if ok {
-        // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-        // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-        err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").
-                And("Item.Fid = ?", fid).And("Item.Id != ?", id).And("Item.Read=0").Limit(n, 0).Find(&list)
+        sql := fmt.Sprintf("select %s from Item inner join Feed on Item.Fid=Feed.Id where Item.Fid = ? and Item.Id != ? and Item.Read=0 limit %d",
+            articleListColumns, n)
+        err = session.Sql(sql, fid, id).Find(&list)
         if err != nil {
             return
         }
@@ -423,10 +479,9 @@ func GetRelatedArticles(id int64, n int) (list []*Article, err error) {
 
         var articles []*Article
 
-        // BUG: Omit("Item.Content") doesn't work, still select all columns, waiting xorm team to fix it.
-        // opened an issue at: https://github.com/go-xorm/xorm/issues/222
-        err = session.Omit("Item.Content").Table("Item").Join("INNER", "Feed", "Item.Fid=Feed.Id").
-            And("Item.Read=0").And("Feed.Id != ?", fid).OrderBy("RANDOM()").Limit(n).Find(&articles)
+        sql := fmt.Sprintf("select %s from Item inner join Feed on Item.Fid=Feed.Id where Item.Read=0 and Feed.Id != ? order by random() limit %d",
+            articleListColumns, n)
+        err = session.Sql(sql, fid).Find(&articles)
         if err != nil {
             return
         }
@@ -439,24 +494,64 @@ func GetRelatedArticles(id int64, n int) (list []*Article, err error) {
 }
 
 
-// Get feed ids by tag name.
-func getFeedIdsByTag(session *xorm.Session, tag string) (fids []int64, err error) {
-    var t []*Tag
-    err = session.Cols("Fid").Where("Name = ?", tag).Find(&t)
+/*
+Get the same article in other feeds: articles which have the same url as the article of id, in other feeds.
+They are ordered by Item.Id, list is empty if the article is only in one feed or it has no url.
+*/
+func GetSameArticles(id int64) (list []*Article, err error) {
+    sql := fmt.Sprintf(`select %s from Item inner join Feed on Item.Fid=Feed.Id
+        where Item.Url != '' and Item.Url = (select Url from Item where Id = ?) and Item.Fid != (select Fid from Item where Id = ?)
+        order by Item.Id`, articleListColumns)
+    err = global.Orm.Sql(sql, id, id).Find(&list)
+    return
+}
+
+
+// Max number of characters of content loaded for an excerpt of n characters, html tags in content are counted.
+func excerptContentLength(n int) int {
+    return n * 4 + 1024
+}
+
+
+/*
+Load the beginning of content of articles to Article.Excerpt for making excerpts of n characters.
+Excerpt is raw html and may be cut in the middle of a tag, it should be converted to plain text by utils.Excerpt().
+*/
+func LoadExcerpts(articles []*Article, n int) (err error) {
+    if len(articles) == 0 || n <= 0 {
+        return
+    }
+
+    var args []interface{}
+    args = append(args, excerptContentLength(n))
+    for _, a := range articles {
+        args = append(args, a.Item.Id)
+    }
+
+    sql := fmt.Sprintf("select Id, substr(Content, 1, ?) as Content from Item where Id in (%s)",
+        strings.TrimSuffix(strings.Repeat("?,", len(articles)), ","))
+
+    var items []*Item
+    err = global.Orm.Sql(sql, args...).Find(&items)
     if err != nil {
         return
     }
-    for _, i := range t {
-        fids = append(fids, i.Fid)
+
+    content := make(map[int64]string)
+    for _, item := range items {
+        content[item.Id] = item.Content
+    }
+    for _, a := range articles {
+        a.Excerpt = content[a.Item.Id]
     }
     return
 }
 
 
-// Get feed ids by tags.
-func getFeedIdsByTags(session *xorm.Session, tags []string) (fids []int64, err error) {
+// Get feed ids by tag name.
+func getFeedIdsByTag(session *xorm.Session, tag string) (fids []int64, err error) {
     var t []*Tag
-    err = session.Cols("Fid").In("Name", tags).Find(&t)
+    err = session.Cols("Fid").Where("Name = ?", tag).Find(&t)
     if err != nil {
         return
     }
@@ -535,6 +630,7 @@ type FeedInfo struct {
     Read    uint64
     Unread  uint64
     Starred uint64
+    NextFetch *time.Time    // next scheduled fetch, nil if the feed is not going to be updated
 }
 
 
@@ -585,6 +681,13 @@ func GetFeedInfo(fid int64) (feedinfo *FeedInfo, err error) {
 
     session.Commit()
 
+    if autoUpdateInterval > 0 {
+        t, ok := nextFetchTime(&feed.Feed, autoUpdateInterval)
+        if ok {
+            feed.NextFetch = &t
+        }
+    }
+
     feedinfo = &feed
 
     return
@@ -593,6 +696,16 @@ func GetFeedInfo(fid int64) (feedinfo *FeedInfo, err error) {
 
 // Modify table Feed.
 func UpdateFeed(fid int64, feed *Feed) (ok bool, err error) {
+
+    // A suspended feed is resumed when its interval is saved, its failure counter is reset, so it will not be
+    // suspended again at once.
+    if feed.Interval != nil && *feed.Interval >= 0 {
+        _, err = global.Orm.Exec("update Feed set Suspended = 0, FailCount = 0 where Id = ? and Suspended = 1", fid)
+        if err != nil {
+            return
+        }
+    }
+
     affected, err := global.Orm.Id(fid).Update(feed)
     if affected > 0 {
         ok = true
@@ -661,17 +774,25 @@ func UpdateTags(fid int64, tags []string) (err error) {
         return
     }
 
-    tags = trimTags(tags)
+    err = saveTags(session, fid, trimTags(tags))
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    session.Commit()
+    return
+}
 
+
+// Add tags to a feed, tags should be trimmed by trimTags().
+func saveTags(session *xorm.Session, fid int64, tags []string) (err error) {
     for _, tag := range tags {
         _, err = session.Insert(&Tag{Name: tag, Fid: fid})
         if err != nil {
-            session.Rollback()
             return
         }
     }
-
-    session.Commit()
     return
 }
 
@@ -717,7 +838,7 @@ func MarkArticlesStarred(ids []int64, status bool) (affected int64, err error) {
 }
 
 
-// Delete a feed, including associated articles and tags.
+// Delete a feed, including associated articles, tags and tags of articles.
 func DeleteFeed(fid int64) (err error) {
 
     session := global.Orm.NewSession()
@@ -740,18 +861,7 @@ func DeleteFeed(fid int64) (err error) {
         return
     }
 
-    _, err = session.Where("Fid = ?", fid).Delete(&Item{})
-    if err != nil {
-        session.Rollback()
-        return
-    }
-
-    _, err = session.Where("Fid = ?", fid).Delete(&Tag{})
-    if err != nil {
-        session.Rollback()
-        return
-    }
-
+    // items, tags of the feed and tags of the items are deleted by foreign keys
     _, err = session.Where("Id = ?", fid).Delete(&Feed{})
     if err != nil {
         session.Rollback()
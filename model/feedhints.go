@@ -0,0 +1,217 @@
+package model
+
+import "bytes"
+import "encoding/xml"
+import "io"
+import "net/http"
+import "strconv"
+import "strings"
+import "time"
+
+
+// Max interval (minute) a feed could declare, a feed declares a longer interval will still be fetched once a week.
+const maxDeclaredInterval = 7 * 24 * 60
+
+
+/*
+Hints of how often to poll a feed, declared by the publisher in the feed document:
+
+    RSS:                    <ttl>, <skipHours>, <skipDays>
+    Syndication module:     <sy:updatePeriod>, <sy:updateFrequency>
+*/
+type feedHints struct {
+    Ttl             int         // minutes
+    UpdatePeriod    string      // hourly, daily, weekly, monthly or yearly
+    UpdateFrequency int         // times of updating in an UpdatePeriod
+    SkipHours       []int       // 0-23, GMT
+    SkipDays        []string    // Monday, Tuesday, ...
+}
+
+
+// Parse polling hints of a feed document. Errors are ignored, hints parsed before the error are returned.
+func parseFeedHints(doc []byte) (hints feedHints) {
+
+    decoder := xml.NewDecoder(bytes.NewReader(doc))
+    decoder.Strict = false
+    // hints are ascii strings, so the document is read as is whatever the charset is.
+    decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+        return input, nil
+    }
+
+    var path []string
+
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            return
+        }
+
+        switch t := token.(type) {
+            case xml.StartElement:
+                name := strings.ToLower(t.Name.Local)
+                if name == "item" || name == "entry" {
+                    // no hints in items
+                    decoder.Skip()
+                    continue
+                }
+                if strings.Contains(t.Name.Space, "syndication") {
+                    name = "sy:" + name
+                }
+                path = append(path, name)
+
+            case xml.EndElement:
+                if len(path) > 0 {
+                    path = path[:len(path) - 1]
+                }
+
+            case xml.CharData:
+                if len(path) == 0 {
+                    continue
+                }
+                value := strings.TrimSpace(string(t))
+                if value == "" {
+                    continue
+                }
+
+                parent := ""
+                if len(path) > 1 {
+                    parent = path[len(path) - 2]
+                }
+
+                switch path[len(path) - 1] {
+                    case "ttl":
+                        hints.Ttl, _ = strconv.Atoi(value)
+
+                    case "sy:updateperiod":
+                        hints.UpdatePeriod = strings.ToLower(value)
+
+                    case "sy:updatefrequency":
+                        hints.UpdateFrequency, _ = strconv.Atoi(value)
+
+                    case "hour":
+                        hour, e := strconv.Atoi(value)
+                        if parent == "skiphours" && e == nil && hour >= 0 && hour <= 24 {
+                            // some feeds use 1-24 instead of 0-23
+                            hints.SkipHours = append(hints.SkipHours, hour % 24)
+                        }
+
+                    case "day":
+                        if parent == "skipdays" {
+                            for d := time.Sunday; d <= time.Saturday; d++ {
+                                if strings.EqualFold(d.String(), value) {
+                                    hints.SkipDays = append(hints.SkipDays, d.String())
+                                }
+                            }
+                        }
+                }
+        }
+    }
+}
+
+
+// Get min interval (minute) declared by the feed, 0 if the feed does not declare it.
+func (this *feedHints) minInterval() (minutes int) {
+
+    if this.Ttl > 0 {
+        minutes = this.Ttl
+    }
+
+    if this.UpdatePeriod != "" {
+        var period int
+        switch this.UpdatePeriod {
+            case "hourly":  period = 60
+            case "daily":   period = 24 * 60
+            case "weekly":  period = 7 * 24 * 60
+            case "monthly": period = 30 * 24 * 60
+            case "yearly":  period = 365 * 24 * 60
+        }
+
+        frequency := this.UpdateFrequency
+        if frequency <= 0 {
+            frequency = 1
+        }
+
+        if m := period / frequency; m > minutes {
+            minutes = m
+        }
+    }
+
+    if minutes > maxDeclaredInterval {
+        minutes = maxDeclaredInterval
+    }
+    return
+}
+
+
+// Save hints to a Feed structure.
+func (this *feedHints) apply(feed *Feed) {
+    feed.MinInterval = this.minInterval()
+
+    var hours []string
+    for _, h := range this.SkipHours {
+        hours = append(hours, strconv.Itoa(h))
+    }
+    feed.SkipHours = strings.Join(hours, ",")
+    feed.SkipDays = strings.Join(this.SkipDays, ",")
+}
+
+
+/*
+Move t to the first hour which is not in skipHours or skipDays.
+
+skipHours is comma separated hours in GMT (e.g. "0,1,2"), skipDays is comma separated names of weekday (e.g. "Saturday,Sunday").
+*/
+func skipTime(t time.Time, skipHours, skipDays string) time.Time {
+
+    if skipHours == "" && skipDays == "" {
+        return t
+    }
+
+    hours := make(map[int]bool)
+    for _, h := range strings.Split(skipHours, ",") {
+        hour, err := strconv.Atoi(h)
+        if err == nil {
+            hours[hour] = true
+        }
+    }
+
+    days := make(map[string]bool)
+    for _, d := range strings.Split(skipDays, ",") {
+        days[d] = true
+    }
+
+    next := t
+    // check at most one week, if all the hours are skipped, return t.
+    for i := 0; i < 7 * 24; i++ {
+        u := next.UTC()
+        if !hours[u.Hour()] && !days[u.Weekday().String()] {
+            return next
+        }
+        next = next.Truncate(time.Hour).Add(time.Hour)
+    }
+
+    return t
+}
+
+
+// Parse value of http header Retry-After, which could be seconds or a http date. Return zero time if value is not correct.
+func parseRetryAfter(value string, now time.Time) (t time.Time) {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return
+    }
+
+    seconds, err := strconv.Atoi(value)
+    if err == nil {
+        if seconds > 0 {
+            t = now.Add(time.Duration(seconds) * time.Second)
+        }
+        return
+    }
+
+    d, err := http.ParseTime(value)
+    if err == nil {
+        t = d
+    }
+    return
+}
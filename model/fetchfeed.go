@@ -1,13 +1,16 @@
 package model
 
+import "context"
 import "crypto/md5"
+import "crypto/sha1"
+import "io/ioutil"
 import "fmt"
 import "time"
 import "strings"
 import "sync"
+import "net/http"
 import "github.com/go-xorm/xorm"
 import "github.com/m3ng9i/feedreader"
-import h "github.com/m3ng9i/go-utils/http"
 import "github.com/m3ng9i/qreader/global"
 
 
@@ -28,13 +31,15 @@ func IsSubscribed(url string) (s bool, e error) {
 
 /*
 Subscribe a feed. If a feed is already subscribed, a "UNIQUE constraint failed: Feed.Url" error will be return.
+tags are optional tags of the feed, they are saved before items, so global rules with tag conditions are applied
+to the items of the new feed, the same as items fetched later.
 
 return value:
     id      id in table feed
     num     amount of added items
     name    feed name
 */
-func Subscribe(feed *Feed, items []*Item) (id int64, num int64, name string, err error) {
+func Subscribe(feed *Feed, items []*Item, tags ...string) (id int64, num int64, name string, err error) {
 
     session := global.Orm.NewSession()
     defer session.Close()
@@ -44,6 +49,27 @@ func Subscribe(feed *Feed, items []*Item) (id int64, num int64, name string, err
         return
     }
 
+    name = feed.Name
+
+    id, num, err = subscribe(session, feed, items, tags)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    err = session.Commit()
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    return
+}
+
+
+// Insert a feed and its items in a transaction, see Subscribe(). The caller should rollback session if err is not nil.
+func subscribe(session *xorm.Session, feed *Feed, items []*Item, tags []string) (id int64, num int64, err error) {
+
     // Feed.Filter and Feed.Note cannot be null.
     empty := ""
     feed.Alias = &empty
@@ -52,16 +78,15 @@ func Subscribe(feed *Feed, items []*Item) (id int64, num int64, name string, err
 
     var zeroInt int = 0
     var zeroUint uint = 0
+    var no bool = false
     feed.Interval = &zeroInt
     feed.MaxUnread = &zeroUint
     feed.MaxKeep = &zeroUint
-
-    name = feed.Name
+    feed.MarkUpdatedUnread = &no
 
     // insert data to table Feed
     _, err = session.Insert(feed)
     if err != nil {
-        session.Rollback()
         return
     }
 
@@ -69,78 +94,196 @@ func Subscribe(feed *Feed, items []*Item) (id int64, num int64, name string, err
     f := new(Feed)
     _, err = session.Cols("Id").Where("Feedurl = ?", feed.FeedUrl).Get(f)
     if err != nil {
-        session.Rollback()
         return
     }
     id = f.Id
 
+    tags = trimTags(tags)
+    err = saveTags(session, id, tags)
+    if err != nil {
+        return
+    }
+
+    rules, err := loadRules(session)
+    if err != nil {
+        return
+    }
+
     var affected int64
     // insert data to table Item
     for _, item := range items {
         item.Fid = f.Id
-        // ignore error like "UNIQUE constraint failed"
-        affected, _ = session.Insert(item)
+        itemTags := rules.apply(item, tags)
+
+        affected, err = session.Insert(item)
+        if err != nil {
+            // duplicate items of the feed are ignored, see renewFeed()
+            if !isUniqueError(err) {
+                return
+            }
+            global.Logger.Noticef("[MODEL] insert item to table Item failed: %s, fid: %d, title: %s, url:%s, guid: %s",
+                err.Error(), item.Fid, item.Title, item.Url, item.Guid)
+            err = nil
+            continue
+        }
         num += affected
+
+        if affected > 0 && len(itemTags) > 0 {
+            err = saveItemTags(session, item.Id, itemTags)
+            if err != nil {
+                return
+            }
+        }
     }
 
-    err = session.Commit()
+    return
+}
+
+
+// Send a GET request to url. If etag or lastModified is not empty, conditional request headers will be sent.
+func httpGet(ctx context.Context, url string, client *http.Client, etag, lastModified string) (resp *http.Response, err error) {
+    req, err := http.NewRequest("GET", url, nil)
     if err != nil {
-        session.Rollback()
         return
     }
+    req = req.WithContext(ctx)
+
+    req.Header.Set("User-Agent", global.UserAgent)
+    if etag != "" {
+        req.Header.Set("If-None-Match", etag)
+    }
+    if lastModified != "" {
+        req.Header.Set("If-Modified-Since", lastModified)
+    }
 
+    resp, err = client.Do(req)
     return
 }
 
 
-func fetchFeed(url string, fetcher *h.Fetcher) (feed *Feed, items []*Item, err error) {
-    fd, err := feedreader.Fetch(url, fetcher)
+/*
+Fetch and parse a feed.
+
+If remote feed is not modified since last fetch (http status code is 304), notModified will be true,
+and feed and items will be nil. feed.ETag and feed.LastModified are set from the response headers.
+*/
+func fetchFeed(ctx context.Context, url string, client *http.Client, etag, lastModified string) (feed *Feed, items []*Item, notModified bool, err error) {
+    resp, err := httpGet(ctx, url, client, etag, lastModified)
+    if err != nil {
+        err = &FetchError{Url: url, Err: err}
+        return
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode == http.StatusNotModified {
+        notModified = true
+        return
+    }
+    if resp.StatusCode != http.StatusOK {
+        e := &FetchError{Url: url, StatusCode: resp.StatusCode}
+        if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+            e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+        }
+        err = e
+        return
+    }
+
+    doc, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        err = &FetchError{Url: url, StatusCode: resp.StatusCode, Err: err}
+        return
+    }
+
+    fd, err := parseFeedDoc(doc, resp.Header.Get("Content-Type"), url)
     if err != nil {
         return
     }
 
     feed, items = assembleFeed(fd)
+    feed.ETag = resp.Header.Get("ETag")
+    feed.LastModified = resp.Header.Get("Last-Modified")
+
+    hints := parseFeedHints(doc)
+    hints.apply(feed)
     return
 }
 
 
 // Fetch a feed normally or behind a proxy.
 func FetchFeed(url string) (feed *Feed, items []*Item, err error) {
+    feed, items, _, err = FetchFeedIfModified(url, "", "")
+    return
+}
+
+
+/*
+Fetch a feed normally or behind a proxy, with conditional request headers If-None-Match and If-Modified-Since.
+etag and lastModified are values of ETag and Last-Modified headers of last fetch, they could be empty.
+
+If remote feed is not modified, notModified will be true, feed and items will be nil.
+*/
+func FetchFeedIfModified(url, etag, lastModified string) (feed *Feed, items []*Item, notModified bool, err error) {
+    return fetchFeedIfModified(context.Background(), url, etag, lastModified)
+}
+
+
+// Same as FetchFeedIfModified, the fetching will be canceled when ctx is done.
+func fetchFeedIfModified(ctx context.Context, url, etag, lastModified string) (feed *Feed, items []*Item, notModified bool, err error) {
 
     msgNormally := fmt.Sprintf("[FETCH] Fetch feed '%s' normally", url)
     msgProxy := fmt.Sprintf("[FETCH] Fetch feed '%s' behind proxy", url)
 
-    if global.UseProxy == global.PROXY_ALWAYS {
-        feed, items, err = fetchFeed(url, global.Socks5Fetcher)
+    logResult := func(msg string) {
         if err != nil {
-            global.Logger.Errorf("%s: %s", msgProxy, err.Error())
+            global.Logger.Errorf("%s: %s", msg, err.Error())
+        } else if notModified {
+            global.Logger.Infof("%s: not modified (304), skip parsing", msg)
         } else {
-            global.Logger.Infof(msgProxy)
+            global.Logger.Infof(msg)
         }
-        return
     }
 
-    feed, items, err = fetchFeed(url, global.NormalFetcher)
-    if err == nil {
-        global.Logger.Infof(msgNormally)
+    if global.UseProxy == global.PROXY_ALWAYS {
+        feed, items, notModified, err = fetchFeed(ctx, url, global.Socks5Client, etag, lastModified)
+        logResult(msgProxy)
         return
     }
-    if err != nil {
-        global.Logger.Errorf("%s: %s", msgNormally, err.Error())
 
-        if global.UseProxy == global.PROXY_TRY {
-            feed, items, err = fetchFeed(url, global.Socks5Fetcher)
-            if err != nil {
-                global.Logger.Errorf("%s: %s", msgProxy, err.Error())
-            } else {
-                global.Logger.Infof(msgProxy)
-            }
-        }
+    feed, items, notModified, err = fetchFeed(ctx, url, global.NormalClient, etag, lastModified)
+    logResult(msgNormally)
+
+    if err != nil && ctx.Err() == nil && global.UseProxy == global.PROXY_TRY {
+        feed, items, notModified, err = fetchFeed(ctx, url, global.Socks5Client, etag, lastModified)
+        logResult(msgProxy)
     }
 
     return
 }
 
+
+const fallbackGuidPrefix = "qreader:"
+
+
+/*
+Identity of an item which has no guid: a hash of link, title and pubtime (if any), prefixed by "qreader:".
+Items without guid in a feed are distinguished by it, instead of colliding on the empty guid.
+*/
+func fallbackGuid(link, title string, pubTime time.Time) string {
+    h := sha1.New()
+    fmt.Fprintf(h, "%s\n%s\n", link, title)
+    if !pubTime.IsZero() {
+        fmt.Fprint(h, pubTime.Unix())
+    }
+    return fallbackGuidPrefix + fmt.Sprintf("%x", h.Sum(nil))
+}
+
+
+// Check if a guid is made by fallbackGuid().
+func isFallbackGuid(guid string) bool {
+    return strings.HasPrefix(guid, fallbackGuidPrefix)
+}
+
+
 func assembleFeed(fd *feedreader.Feed) (feed *Feed, items []*Item)  {
 
     now := time.Now()
@@ -161,7 +304,7 @@ func assembleFeed(fd *feedreader.Feed) (feed *Feed, items []*Item)  {
         }
 
         item.Url        = i.Link
-        item.Guid       = i.Guid
+        item.Guid       = strings.TrimSpace(i.Guid)
         item.Title      = i.Title
         item.Content    = i.Content
         item.FetchTime  = now
@@ -171,6 +314,10 @@ func assembleFeed(fd *feedreader.Feed) (feed *Feed, items []*Item)  {
             item.PubTime = i.Updated
         }
 
+        if item.Guid == "" {
+            item.Guid = fallbackGuid(item.Url, item.Title, item.PubTime)
+        }
+
         h := md5.New()
         fmt.Fprint(h, item.Content)
         item.Hash = fmt.Sprintf("%x", h.Sum(nil))
@@ -186,12 +333,16 @@ type FeedRenewInfo struct {
     Id          int64
     Feed        *Feed
     Items       []*Item
+    NotModified bool        // remote feed is not modified since last fetch
     FetchTime   time.Time
     FetchError  error
+    Filter      string      // Feed.Filter, applied on items before inserting
+    MarkUpdatedUnread bool  // Feed.MarkUpdatedUnread, whether to mark changed items unread again
 }
 
 
-func fetchFeedAndItems(id int64) (info FeedRenewInfo, err error) {
+// Fetch a feed by Feed.Id. If ctx is done, the fetching will be canceled and not be recorded as a failure.
+func fetchFeedAndItems(ctx context.Context, id int64) (info FeedRenewInfo, err error) {
 
     feed, ok, err := GetFeed(id)
     if err != nil {
@@ -203,14 +354,22 @@ func fetchFeedAndItems(id int64) (info FeedRenewInfo, err error) {
     }
 
     info.Id = id
-    info.Feed, info.Items, info.FetchError = FetchFeed(feed.FeedUrl)
+    if feed.Filter != nil {
+        info.Filter = *feed.Filter
+    }
+    if feed.MarkUpdatedUnread != nil {
+        info.MarkUpdatedUnread = *feed.MarkUpdatedUnread
+    }
+    info.Feed, info.Items, info.NotModified, info.FetchError = fetchFeedIfModified(ctx, feed.FeedUrl, feed.ETag, feed.LastModified)
     info.FetchTime = time.Now()
 
+    if info.FetchError != nil && ctx.Err() != nil {
+        err = ctx.Err()
+        return
+    }
+
     if info.FetchError != nil {
-        f := new(Feed)
-        f.LastFailed = info.FetchTime
-        f.LastError = info.FetchError.Error()
-        _, e := global.Orm.Id(info.Id).Update(f)
+        e := recordFetchFailure(info.Id, info.FetchTime, info.FetchError)
         if e != nil {
             err = e
         } else {
@@ -220,7 +379,7 @@ func fetchFeedAndItems(id int64) (info FeedRenewInfo, err error) {
     }
 
     // If feed has no items, record as an error.
-    if len(info.Items) == 0 {
+    if !info.NotModified && len(info.Items) == 0 {
         info.FetchError = ErrFeedHasNoItems
         err = info.FetchError
     }
@@ -229,6 +388,72 @@ func fetchFeedAndItems(id int64) (info FeedRenewInfo, err error) {
 }
 
 
+/*
+Record a failed fetch: update LastFailed, LastError and increase FailCount.
+If FailCount reaches global.FetchMaxFailures, the feed will be suspended (Feed.Suspended), its Interval is not changed.
+It will be resumed by a successful fetch (e.g. updated manually), see renewFeed(), or by saving its interval.
+
+If the server asked to retry later (http status 429 or 503 with Retry-After header), RetryAfter will be updated,
+and FailCount will not be increased.
+*/
+func recordFetchFailure(fid int64, failed time.Time, fetchError error) (err error) {
+
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+
+    f := new(Feed)
+    f.LastFailed = failed
+    f.LastError = fetchError.Error()
+
+    throttled := false
+    if e, ok := fetchError.(*FetchError); ok && !e.RetryAfter.IsZero() {
+        f.RetryAfter = e.RetryAfter
+        throttled = true
+    }
+
+    _, err = session.Id(fid).Update(f)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    if throttled {
+        err = session.Commit()
+        return
+    }
+
+    _, err = session.Exec("update Feed set FailCount = FailCount + 1 where Id = ?", fid)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    f = new(Feed)
+    _, err = session.Cols("FailCount", "Suspended").Where("Id = ?", fid).Get(f)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    if global.FetchMaxFailures > 0 && f.FailCount >= int(global.FetchMaxFailures) && !f.Suspended {
+        _, err = session.Exec("update Feed set Suspended = 1 where Id = ?", fid)
+        if err != nil {
+            session.Rollback()
+            return
+        }
+        global.Logger.Warnf("[FETCH] Feed is suspended after %d consecutive failures: fid: %d", f.FailCount, fid)
+    }
+
+    err = session.Commit()
+    return
+}
+
+
 func renewFeed(info FeedRenewInfo) (affected int64, err error) {
 
     session := global.Orm.NewSession()
@@ -239,21 +464,92 @@ func renewFeed(info FeedRenewInfo) (affected int64, err error) {
         return
     }
 
+    // Remote feed is not modified, only update the last fetch time, reset the failure counter and resume the feed
+    // if it's suspended (e.g. it's updated manually).
+    if info.NotModified {
+        _, err = session.Id(info.Id).Update(&Feed{LastFetch: info.FetchTime})
+        if err != nil {
+            session.Rollback()
+            return
+        }
+        _, err = session.Exec("update Feed set FailCount = 0, Suspended = 0 where Id = ?", info.Id)
+        if err != nil {
+            session.Rollback()
+            return
+        }
+        err = session.Commit()
+        return
+    }
+
     _, err = session.Id(info.Id).Update(info.Feed)
     if err != nil {
         session.Rollback()
         return
     }
 
+    // Zero values are ignored by Update(), so ETag, LastModified and polling hints are updated separately,
+    // in case the server stops sending them. The failure counter is reset and a suspended feed is resumed at the same time.
+    _, err = session.Exec(`update Feed set ETag = ?, LastModified = ?, MinInterval = ?, SkipHours = ?, SkipDays = ?,
+                           FailCount = 0, Suspended = 0 where Id = ?`,
+        info.Feed.ETag, info.Feed.LastModified, info.Feed.MinInterval, info.Feed.SkipHours, info.Feed.SkipDays, info.Id)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    // A filter which cannot be parsed is ignored, it should have been checked before saving.
+    filter, e := ParseFilter(info.Filter)
+    if e != nil {
+        global.Logger.Errorf("[FILTER] filter of feed is not correct: %s, fid: %d", e.Error(), info.Id)
+        filter = nil
+    }
+
+    rules, err := loadRules(session)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    tags, err := getTagsByFid(session, info.Id)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    // guids of fetched items, for telling an item from another one with the same url, see updateChangedItem()
+    fetched := make(map[string]bool)
+    for _, item := range info.Items {
+        fetched[item.Guid] = true
+    }
+
     for _, item := range info.Items {
         item.Fid = info.Id
+
+        if filter.Apply(item) {
+            global.Logger.Debugf("[FILTER] item dropped, fid: %d, title: %s, url: %s", info.Id, item.Title, item.Url)
+            continue
+        }
+
+        itemTags := rules.apply(item, tags)
+
         num, e := session.Insert(item)
         if e != nil {
             // Table Item has some unique indexes for preventing insert duplicate data.
-            // So these errors should be ignored.
-            if strings.HasPrefix(e.Error(), "UNIQUE constraint failed") {
-                global.Logger.Noticef("[MODEL] insert item to table Item failed: %s, fid: %d, title: %s, url:%s, guid: %s",
-                    e.Error(), info.Id, item.Title, item.Url, item.Guid)
+            // So these errors should be ignored, but the existing item is updated if it has been changed.
+            if isUniqueError(e) {
+                updated, er := updateChangedItem(session, item, info.MarkUpdatedUnread, fetched)
+                if er != nil {
+                    session.Rollback()
+                    err = er
+                    return
+                }
+                if updated {
+                    global.Logger.Infof("[MODEL] item is changed and updated, fid: %d, id: %d, title: %s, url: %s",
+                        info.Id, item.Id, item.Title, item.Url)
+                } else {
+                    global.Logger.Noticef("[MODEL] insert item to table Item failed: %s, fid: %d, title: %s, url:%s, guid: %s",
+                        e.Error(), info.Id, item.Title, item.Url, item.Guid)
+                }
                 continue
             } else {
                 session.Rollback()
@@ -262,6 +558,14 @@ func renewFeed(info FeedRenewInfo) (affected int64, err error) {
             }
         }
         affected += num
+
+        if num > 0 && len(itemTags) > 0 {
+            err = saveItemTags(session, item.Id, itemTags)
+            if err != nil {
+                session.Rollback()
+                return
+            }
+        }
     }
 
     err = session.Commit()
@@ -271,9 +575,9 @@ func renewFeed(info FeedRenewInfo) (affected int64, err error) {
 
 // Renew a feed: fetch new items of feed, and insert them into Item table.
 // If some information of remote feed has changed, e.g. feed name, description, they'll be synced to Feed table.
-// If returned error is not nil, it will be feedreader.FetchError, feedreader.ParseError or common error.
+// If returned error is not nil, it will be FetchError, feedreader.ParseError, FeedParseError or common error.
 func RenewFeed(id int64) (affected int64, err error) {
-    feedInfo, err := fetchFeedAndItems(id)
+    feedInfo, err := fetchFeedAndItems(context.Background(), id)
     if err != nil {
         return
     }
@@ -282,6 +586,75 @@ func RenewFeed(id int64) (affected int64, err error) {
 }
 
 
+// Default interval (minute) of updating feeds, set by AutoUpdateFeed(). 0 means feeds are not updated automatically.
+var autoUpdateInterval uint
+
+
+/*
+Get delay before retrying a failed feed.
+
+The first retry is 1 hour after the failure, the delay will be doubled after each consecutive failure,
+but not greater than global.FetchBackoffMax.
+*/
+func retryDelay(failCount int) time.Duration {
+    max := time.Duration(global.FetchBackoffMax) * time.Minute
+    if max < time.Hour {
+        max = time.Hour
+    }
+
+    delay := time.Hour
+    for i := 1; i < failCount && delay < max; i++ {
+        delay *= 2
+    }
+    if delay > max {
+        delay = max
+    }
+    return delay
+}
+
+
+/*
+Get next time to fetch a feed. interval is the default interval (minute) of updating feeds.
+
+If the user has not set an Interval for the feed, polling hints declared by the feed (MinInterval, SkipHours and SkipDays)
+are respected, the interval will not be shorter than MinInterval. RetryAfter asked by the server is always respected.
+
+If a feed is not going to be updated (Interval is below zero or the feed is suspended), ok will be false.
+*/
+func nextFetchTime(feed *Feed, interval uint) (t time.Time, ok bool) {
+
+    if feed.Suspended || feed.Interval == nil || *feed.Interval < 0 {
+        return
+    }
+
+    if *feed.Interval == 0 {
+        minutes := int(interval)
+        if feed.MinInterval > minutes {
+            minutes = feed.MinInterval
+        }
+        t = feed.LastFetch.Add(time.Duration(minutes) * time.Minute)
+        t = skipTime(t, feed.SkipHours, feed.SkipDays)
+    } else {
+        t = feed.LastFetch.Add(time.Duration(*feed.Interval) * time.Minute)
+    }
+
+    // if fetch failed, try again later. A throttled fetch does not increase FailCount, it's delayed by RetryAfter only.
+    if feed.FailCount > 0 {
+        retry := feed.LastFailed.Add(retryDelay(feed.FailCount))
+        if retry.After(t) {
+            t = retry
+        }
+    }
+
+    if feed.RetryAfter.After(t) {
+        t = feed.RetryAfter
+    }
+
+    ok = true
+    return
+}
+
+
 // Get feed.Ids that need to update
 func GetFidsNeedToUpdate(interval uint) (fids []int64, err error) {
 
@@ -292,13 +665,13 @@ func GetFidsNeedToUpdate(interval uint) (fids []int64, err error) {
 
     var feeds []*Feed
 
-    err = global.Orm.Cols("Id", "Interval", "LastFetch", "LastFailed").Asc("LastFetch").Find(&feeds)
+    err = global.Orm.Cols("Id", "Interval", "Suspended", "LastFetch", "LastFailed", "FailCount",
+                          "MinInterval", "SkipHours", "SkipDays", "RetryAfter").Asc("LastFetch").Find(&feeds)
     if err != nil {
         return
     }
 
     now := time.Now()
-    var t time.Time
 
     for _, feed := range feeds {
 
@@ -306,22 +679,9 @@ func GetFidsNeedToUpdate(interval uint) (fids []int64, err error) {
             continue
         }
 
-        if *feed.Interval < 0 {
-            continue
-        }
-
-        if *feed.Interval == 0 {
-            t = feed.LastFetch.Add(time.Duration(interval) * time.Minute)
-        } else {
-            t = feed.LastFetch.Add(time.Duration(*feed.Interval) * time.Minute)
-        }
-
-        if t.Before(now) {
-            // if fetch failed, try again 1 hour later.
-            t = feed.LastFailed.Add(time.Hour)
-            if t.Before(now) {
-                fids = append(fids, feed.Id)
-            }
+        t, ok := nextFetchTime(feed, interval)
+        if ok && t.Before(now) {
+            fids = append(fids, feed.Id)
         }
     }
 
@@ -423,11 +783,24 @@ func TrimData() (markread, deleted int64, err error) {
 }
 
 
-func AutoUpdateFeed(interval uint) {
+/*
+Update feeds automatically in background.
+
+Every global.UpdateCheckPeriod minutes, feeds need to update are fetched (global.FetchConcurrency feeds at one time at most),
+then saved to database one by one. global.UpdateInterval is the default interval of updating feeds.
+
+When ctx is done, no more feeds will be fetched, fetches in progress are canceled, and feeds already fetched
+will still be saved. The returned channel will be closed after all the fetched feeds are saved.
+*/
+func AutoUpdateFeed(ctx context.Context) <-chan struct{} {
+
+    interval := global.UpdateInterval
+    autoUpdateInterval = interval
 
-    renewInfo := make(chan FeedRenewInfo, 30)
+    renewInfo := make(chan FeedRenewInfo, global.RenewQueueSize)
+    done := make(chan struct{})
 
-    // a goroutine for renewing feed
+    // a goroutine for renewing feed, it exits after renewInfo is closed and drained.
     go func(renew chan FeedRenewInfo) {
         for feed := range renew {
             affected, err := renewFeed(feed)
@@ -437,10 +810,16 @@ func AutoUpdateFeed(interval uint) {
                 global.Logger.Infof("[SYSTEM] Auto update success: fid:%d, add %d articles.", feed.Id, affected)
             }
         }
+        global.Logger.Info("[SYSTEM] Auto update: stopped.")
+        close(done)
     }(renewInfo)
 
     // a goroutine for fetching feed
     go func(renew chan FeedRenewInfo) {
+
+        // no more feeds will be sent to renew after this goroutine returns.
+        defer close(renew)
+
         for {
             fids, err := GetFidsNeedToUpdate(interval)
             if err != nil {
@@ -451,19 +830,24 @@ func AutoUpdateFeed(interval uint) {
             if len(fids) > 0 {
                 var wg sync.WaitGroup
 
-                // fetch 5 feeds at one time at most
-                maxFetch := make(chan bool, 5)
+                // fetch global.FetchConcurrency feeds at one time at most
+                maxFetch := make(chan bool, global.FetchConcurrency)
 
                 for _, fid := range fids {
                     wg.Add(1)
                     go func(feedid int64) {
                         maxFetch <- true
 
-                        feedInfo, err := fetchFeedAndItems(feedid)
-                        if err != nil {
-                            global.Logger.Errorf("[SYSTEM] Auto update failed: fid:%d, %s", feedid, err.Error())
-                        } else {
-                            renew <- feedInfo
+                        // do not start new fetching after shutdown is requested
+                        if ctx.Err() == nil {
+                            feedInfo, err := fetchFeedAndItems(ctx, feedid)
+                            if err != nil {
+                                if ctx.Err() == nil {
+                                    global.Logger.Errorf("[SYSTEM] Auto update failed: fid:%d, %s", feedid, err.Error())
+                                }
+                            } else {
+                                renew <- feedInfo
+                            }
                         }
 
                         <- maxFetch
@@ -471,18 +855,33 @@ func AutoUpdateFeed(interval uint) {
                     }(fid)
                 }
                 wg.Wait()
+
+                if ctx.Err() != nil {
+                    global.Logger.Info("[SYSTEM] Auto update: fetching is canceled.")
+                    return
+                }
                 global.Logger.Info("[SYSTEM] Auto update: finish fetching.")
             } else {
                 global.Logger.Info("[SYSTEM] Auto update: no feed need to update.")
             }
 
-            // after fetching, wait a minute for database updating, then trim data.
-            <- time.After(time.Minute)
+            // after fetching, wait a while for database updating, then trim data.
+            select {
+                case <- ctx.Done():
+                    return
+                case <- time.After(time.Duration(global.TrimDataWait) * time.Second):
+            }
             TrimData()
 
             // try again after few minutes
             NEXT:
-            <- time.After(10 * time.Minute)
+            select {
+                case <- ctx.Done():
+                    return
+                case <- time.After(time.Duration(global.UpdateCheckPeriod) * time.Minute):
+            }
         }
     }(renewInfo)
+
+    return done
 }
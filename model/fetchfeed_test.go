@@ -0,0 +1,105 @@
+package model
+
+import "errors"
+import "testing"
+import "time"
+import "github.com/m3ng9i/qreader/global"
+
+
+// A feed suspended after consecutive failures keeps its interval, and is resumed when its interval is saved or it's fetched.
+func TestResumeSuspendedFeed(t *testing.T) {
+    defer openTestDB(t)()
+
+    maxFailures := global.FetchMaxFailures
+    global.FetchMaxFailures = 2
+    defer func() { global.FetchMaxFailures = maxFailures }()
+
+    feed, _ := testFeedWithoutGuid(nil, nil)
+    fid, _, _, err := Subscribe(feed, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    interval := 30
+    _, err = UpdateFeed(fid, &Feed{Interval: &interval})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for i := 0; i < 2; i++ {
+        err = recordFetchFailure(fid, time.Now(), errors.New("failed"))
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    f, _, err := GetFeed(fid)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !f.Suspended || f.Interval == nil || *f.Interval != interval {
+        t.Fatalf("after failures: got suspended %v, interval %v, want suspended with interval %d", f.Suspended, f.Interval, interval)
+    }
+    if _, ok := nextFetchTime(f, 60); ok {
+        t.Error("a suspended feed should not be fetched")
+    }
+
+    _, err = UpdateFeed(fid, &Feed{Interval: &interval})
+    if err != nil {
+        t.Fatal(err)
+    }
+    f, _, err = GetFeed(fid)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if f.Suspended || f.FailCount != 0 || *f.Interval != interval {
+        t.Errorf("after resuming: got suspended %v, fail count %d, interval %d", f.Suspended, f.FailCount, *f.Interval)
+    }
+
+    // a successful fetch (e.g. updated manually) resumes the feed too
+    for _, notModified := range []bool{false, true} {
+        for i := 0; i < 2; i++ {
+            err = recordFetchFailure(fid, time.Now(), errors.New("failed"))
+            if err != nil {
+                t.Fatal(err)
+            }
+        }
+
+        feed, _ = testFeedWithoutGuid(nil, nil)
+        _, err = renewFeed(FeedRenewInfo{Id: fid, Feed: feed, FetchTime: time.Now(), NotModified: notModified})
+        if err != nil {
+            t.Fatal(err)
+        }
+        f, _, err = GetFeed(fid)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if f.Suspended || f.FailCount != 0 || *f.Interval != interval {
+            t.Errorf("after fetching (not modified: %v): got suspended %v, fail count %d, interval %d",
+                notModified, f.Suspended, f.FailCount, *f.Interval)
+        }
+    }
+}
+
+
+// A throttled fetch sets LastFailed but not FailCount, the next fetch should be at RetryAfter, not after the backoff.
+func TestNextFetchTimeOfThrottledFeed(t *testing.T) {
+    now := time.Now()
+    interval := 1
+    feed := &Feed{
+        Interval:   &interval,
+        LastFetch:  now.Add(-time.Hour),
+        LastFailed: now,
+        RetryAfter: now.Add(5 * time.Minute),
+    }
+
+    next, ok := nextFetchTime(feed, 60)
+    if !ok || !next.Equal(feed.RetryAfter) {
+        t.Errorf("throttled: got %s (%v), want %s", next, ok, feed.RetryAfter)
+    }
+
+    feed.FailCount = 1
+    next, ok = nextFetchTime(feed, 60)
+    if !ok || !next.Equal(now.Add(retryDelay(1))) {
+        t.Errorf("failed: got %s (%v), want %s", next, ok, now.Add(retryDelay(1)))
+    }
+}
@@ -0,0 +1,154 @@
+package model
+
+import "fmt"
+import "strings"
+
+
+type FilterAction string
+const FILTER_READ   FilterAction = "read"   // mark item read
+const FILTER_STAR   FilterAction = "star"   // mark item starred
+const FILTER_DROP   FilterAction = "drop"   // do not save item
+
+
+/*
+A rule of feed filter, the syntax is: <conditions> -> <action>
+
+Conditions use the syntax of Condition, keys "tag" and "fid" are not supported. Actions are: read, star and drop.
+
+Examples:
+
+    title:sponsored -> read
+    author:alice -> star
+    content:"giveaway" -title:review -> drop
+*/
+type FilterRule struct {
+    Condition   Condition
+    Action      FilterAction
+}
+
+
+// A filter contains one or more rules, rules are separated by newline or ';' (not in quotes).
+type Filter []*FilterRule
+
+
+type FilterSyntaxError struct {
+    Rule    string
+    Msg     string
+}
+
+
+func (e *FilterSyntaxError) Error() string {
+    return fmt.Sprintf("%s, rule: '%s'", e.Msg, e.Rule)
+}
+
+
+// Parse a rule of filter.
+func ParseFilterRule(rule string) (r *FilterRule, err error) {
+
+    rule = strings.TrimSpace(rule)
+
+    i := strings.LastIndex(rule, "->")
+    if i < 0 {
+        err = &FilterSyntaxError{rule, "'->' not found"}
+        return
+    }
+
+    condition := strings.TrimSpace(rule[:i])
+    action := FilterAction(strings.ToLower(strings.TrimSpace(rule[i+2:])))
+
+    if action != FILTER_READ && action != FILTER_STAR && action != FILTER_DROP {
+        err = &FilterSyntaxError{rule, fmt.Sprintf("Action is not correct: %s", action)}
+        return
+    }
+
+    if condition == "" {
+        err = &FilterSyntaxError{rule, "Condition is empty"}
+        return
+    }
+
+    c, e := ParseCondition(condition, itemConditionKeys)
+    if e != nil {
+        err = &FilterSyntaxError{rule, e.Error()}
+        return
+    }
+
+    r = &FilterRule{Condition: c, Action: action}
+    return
+}
+
+
+/*
+Split a line of filter to rules by ';' which is not in double quotes, e.g. title:"a;b" -> read is one rule.
+Quotes are kept for parsing the condition, '\' in quotes escapes the next character.
+*/
+func splitFilterRules(line string) (rules []string) {
+    var cur []rune
+    quoted := false
+    escape := false
+
+    for _, r := range line {
+        switch {
+            case escape:
+                escape = false
+            case quoted && r == '\\':
+                escape = true
+            case r == '"':
+                quoted = !quoted
+            case !quoted && r == ';':
+                rules = append(rules, string(cur))
+                cur = nil
+                continue
+        }
+        cur = append(cur, r)
+    }
+
+    return append(rules, string(cur))
+}
+
+
+// Parse a filter. If s is empty, filter will be nil.
+func ParseFilter(s string) (filter Filter, err error) {
+
+    s = strings.Replace(s, "\r", "", -1)
+
+    for _, line := range strings.Split(s, "\n") {
+        for _, rule := range splitFilterRules(line) {
+            if strings.TrimSpace(rule) == "" {
+                continue
+            }
+
+            r, e := ParseFilterRule(rule)
+            if e != nil {
+                err = e
+                filter = nil
+                return
+            }
+            filter = append(filter, r)
+        }
+    }
+
+    return
+}
+
+
+/*
+Apply the filter on an item before it's saved. Actions of all the matched rules are applied:
+"read" and "star" set item.Read and item.Starred, "drop" makes drop to be true, the item should not be saved.
+*/
+func (this Filter) Apply(item *Item) (drop bool) {
+    for _, rule := range this {
+        if !rule.Condition.Match(item, nil) {
+            continue
+        }
+
+        switch rule.Action {
+            case FILTER_READ:
+                item.Read = true
+            case FILTER_STAR:
+                item.Starred = true
+            case FILTER_DROP:
+                drop = true
+        }
+    }
+    return
+}
@@ -0,0 +1,46 @@
+package model
+
+import "reflect"
+import "testing"
+
+
+func TestSplitFilterRules(t *testing.T) {
+    tests := []struct {
+        line    string
+        want    []string
+    }{
+        {"title:a -> read", []string{"title:a -> read"}},
+        {"title:a -> read; author:b -> star", []string{"title:a -> read", " author:b -> star"}},
+        {`title:"a;b" -> read`, []string{`title:"a;b" -> read`}},
+        {`title:"a;b" -> read;content:c -> drop`, []string{`title:"a;b" -> read`, "content:c -> drop"}},
+        {`title:"say \"x;y\"" -> read;`, []string{`title:"say \"x;y\"" -> read`, ""}},
+    }
+
+    for _, test := range tests {
+        if got := splitFilterRules(test.line); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s: got %q, want %q", test.line, got, test.want)
+        }
+    }
+}
+
+
+// A ';' in a quoted value of condition does not separate rules.
+func TestParseFilterQuotedSemicolon(t *testing.T) {
+    filter, err := ParseFilter("title:\"a;b\" -> read; author:alice -> star\ncontent:x -> drop")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(filter) != 3 {
+        t.Fatalf("rules: got %d, want 3", len(filter))
+    }
+
+    item := &Item{Title: "Title with a;b", Author: "alice"}
+    if drop := filter.Apply(item); drop || !item.Read || !item.Starred {
+        t.Errorf("got read %v, starred %v, drop %v, want read and starred", item.Read, item.Starred, drop)
+    }
+
+    item = &Item{Title: "Title with a", Content: "b"}
+    if filter.Apply(item); item.Read {
+        t.Error("the condition should not be cut at ';'")
+    }
+}
@@ -0,0 +1,121 @@
+package model
+
+import "strings"
+import "unicode/utf8"
+import "github.com/m3ng9i/qreader/global"
+
+
+/*
+Whether full-text search is available. It's set by InitDB() or UpgradeDB(), and will be false if SQLite is not built
+with FTS5 (for github.com/mattn/go-sqlite3, build with "-tags sqlite_fts5"), then search will fall back to "like".
+*/
+var ftsEnabled bool
+
+
+/*
+Statements for creating full-text index of table Item.
+
+ItemFts is an external content FTS5 table which indexes Item.Title, Item.Content and Item.Author, kept in sync by triggers.
+The trigram tokenizer is used, so the index matches substrings like "like" does and works for languages without spaces
+between words (e.g. Chinese), but a search term must be at least 3 characters.
+
+These statements contain ';' inside triggers, so they are executed one by one instead of by Orm.Import().
+*/
+var createFtsSql = []string {
+    `create virtual table if not exists ItemFts using fts5(Title, Content, Author, content='Item', content_rowid='Id', tokenize='trigram')`,
+
+    `create trigger if not exists t_item_fts_insert after insert on Item begin
+        insert into ItemFts(rowid, Title, Content, Author) values (new.Id, new.Title, new.Content, new.Author);
+    end`,
+
+    `create trigger if not exists t_item_fts_delete after delete on Item begin
+        insert into ItemFts(ItemFts, rowid, Title, Content, Author) values ('delete', old.Id, old.Title, old.Content, old.Author);
+    end`,
+
+    `create trigger if not exists t_item_fts_update after update of Title, Content, Author on Item begin
+        insert into ItemFts(ItemFts, rowid, Title, Content, Author) values ('delete', old.Id, old.Title, old.Content, old.Author);
+        insert into ItemFts(rowid, Title, Content, Author) values (new.Id, new.Title, new.Content, new.Author);
+    end`,
+}
+
+
+// Triggers which keep ItemFts in sync.
+var ftsTriggers = []string{"t_item_fts_insert", "t_item_fts_delete", "t_item_fts_update"}
+
+
+// Min length (characters) of a search term could be searched by the trigram index.
+const ftsMinTermLength = 3
+
+
+/*
+Create full-text index if not exists. If the index is just created or was out of sync (triggers were missing),
+it will be rebuilt from table Item.
+
+If SQLite does not support FTS5 or trigram tokenizer, triggers are dropped so that inserting items will not fail, and ftsEnabled is false.
+*/
+func initFts() (err error) {
+
+    var count int64
+    err = global.Orm.DB().QueryRow("select count(*) from sqlite_master where type = 'trigger' and name = ?", ftsTriggers[0]).Scan(&count)
+    if err != nil {
+        return
+    }
+    rebuild := count == 0
+
+    for i, sql := range createFtsSql {
+        _, err = global.Orm.Exec(sql)
+        if err != nil {
+            break
+        }
+        if i == 0 {
+            // ItemFts may be created before by a build supports FTS5, query it to make sure FTS5 is available.
+            _, err = global.Orm.Exec("select rowid from ItemFts limit 0")
+            if err != nil {
+                break
+            }
+        }
+    }
+
+    if err != nil {
+        // "no such tokenizer" means SQLite is too old to support trigram tokenizer (3.34.0 is required).
+        if !strings.Contains(err.Error(), "no such module") && !strings.Contains(err.Error(), "no such tokenizer") {
+            return
+        }
+
+        logWarnf("[MODEL] Full-text search is not available (%s), search will be slow on large database.", err.Error())
+        err = nil
+        ftsEnabled = false
+
+        for _, trigger := range ftsTriggers {
+            _, err = global.Orm.Exec("drop trigger if exists " + trigger)
+            if err != nil {
+                return
+            }
+        }
+        return
+    }
+
+    if rebuild {
+        logInfof("[MODEL] Building full-text index, this may take a while.")
+        _, err = global.Orm.Exec("insert into ItemFts(ItemFts) values('rebuild')")
+        if err != nil {
+            return
+        }
+        logInfof("[MODEL] Full-text index is built.")
+    }
+
+    ftsEnabled = true
+    return
+}
+
+
+// Check if a search term could be searched by the full-text index.
+func ftsTerm(term string) bool {
+    return ftsEnabled && utf8.RuneCountInString(term) >= ftsMinTermLength
+}
+
+
+// Create a FTS5 query which matches term in a column, e.g. Title : "term".
+func ftsColumnQuery(column, term string) string {
+    return column + ` : "` + strings.Replace(term, `"`, `""`, -1) + `"`
+}
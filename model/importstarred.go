@@ -0,0 +1,473 @@
+package model
+
+import "bufio"
+import "bytes"
+import "crypto/md5"
+import "encoding/json"
+import "encoding/xml"
+import "fmt"
+import "html"
+import "io"
+import "net/url"
+import "strconv"
+import "strings"
+import "time"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Feed url of the synthetic feed for starred articles whose feed is unknown, e.g. bookmarks.
+const StarredImportFeedUrl = "qreader-import:starred"
+
+
+// Max number of error messages kept in StarredImportResult.
+const maxStarredImportErrors = 100
+
+
+/*
+A starred article read from other reader's export file.
+FeedUrl, FeedName and FeedHtmlUrl describe the feed the article comes from, FeedUrl is empty if it's unknown.
+*/
+type starredEntry struct {
+    Url         string
+    Guid        string
+    Title       string
+    Content     string
+    Author      string
+    PubTime     time.Time
+    Tags        []string
+    FeedUrl     string
+    FeedName    string
+    FeedHtmlUrl string
+}
+
+
+// Report of importing starred articles.
+type StarredImportResult struct {
+    Format      string      `json:"format"`         // "starred.json" or "bookmarks"
+    Imported    int64       `json:"imported"`       // articles added
+    Duplicated  int64       `json:"duplicated"`     // articles already exist, they are marked as starred
+    Rejected    int64       `json:"rejected"`       // entries which are not articles, e.g. without a http url
+    Feeds       int64       `json:"feeds"`          // feeds created for the articles
+    Errors      []string    `json:"errors"`         // reasons of rejected entries, at most maxStarredImportErrors
+}
+
+
+func (this *StarredImportResult) reject(format string, a ...interface{}) {
+    this.Rejected++
+    if len(this.Errors) < maxStarredImportErrors {
+        this.Errors = append(this.Errors, fmt.Sprintf(format, a...))
+    }
+}
+
+
+// Google Reader style starred.json, also exported by FreshRSS, Inoreader, The Old Reader etc.
+type starredJson struct {
+    Items []struct {
+        Id          string          `json:"id"`
+        Title       string          `json:"title"`
+        Published   json.Number     `json:"published"`    // unix time
+        Updated     json.Number     `json:"updated"`
+        Author      string          `json:"author"`
+        Canonical   []struct {
+            Href    string          `json:"href"`
+        }                           `json:"canonical"`
+        Alternate   []struct {
+            Href    string          `json:"href"`
+        }                           `json:"alternate"`
+        Content     struct {
+            Content string          `json:"content"`
+        }                           `json:"content"`
+        Summary     struct {
+            Content string          `json:"content"`
+        }                           `json:"summary"`
+        Categories  []string        `json:"categories"`
+        Origin      struct {
+            StreamId    string      `json:"streamId"`     // "feed/<feed url>", FreshRSS uses "feed/<feed id>"
+            Title       string      `json:"title"`
+            HtmlUrl     string      `json:"htmlUrl"`
+            FeedUrl     string      `json:"feedUrl"`      // FreshRSS only
+        }                           `json:"origin"`
+    }                               `json:"items"`
+}
+
+
+func unixTime(n json.Number) time.Time {
+    i, err := n.Int64()
+    if err != nil || i <= 0 {
+        return time.Time{}
+    }
+    return time.Unix(i, 0)
+}
+
+
+// Parse starred.json. Categories which are not state of the reader (like "user/-/state/com.google/starred") become tags.
+func parseStarredJson(r io.Reader) (entries []*starredEntry, err error) {
+    var doc starredJson
+    err = json.NewDecoder(r).Decode(&doc)
+    if err != nil {
+        return
+    }
+
+    for _, i := range doc.Items {
+        e := new(starredEntry)
+        for _, link := range i.Canonical {
+            if link.Href != "" {
+                e.Url = link.Href
+                break
+            }
+        }
+        if e.Url == "" {
+            for _, link := range i.Alternate {
+                if link.Href != "" {
+                    e.Url = link.Href
+                    break
+                }
+            }
+        }
+
+        e.Guid = i.Id
+        e.Title = i.Title
+        e.Author = i.Author
+        e.Content = i.Content.Content
+        if e.Content == "" {
+            e.Content = i.Summary.Content
+        }
+        e.PubTime = unixTime(i.Published)
+        if e.PubTime.IsZero() {
+            e.PubTime = unixTime(i.Updated)
+        }
+
+        for _, c := range i.Categories {
+            // e.g. "user/-/label/golang" or "user/1234/label/golang"
+            if n := strings.Index(c, "/label/"); n >= 0 {
+                e.Tags = append(e.Tags, c[n + len("/label/"):])
+            }
+        }
+
+        e.FeedUrl = i.Origin.FeedUrl
+        if e.FeedUrl == "" && strings.HasPrefix(i.Origin.StreamId, "feed/") {
+            e.FeedUrl = strings.TrimPrefix(i.Origin.StreamId, "feed/")
+        }
+        if !isHttpUrl(e.FeedUrl) {
+            e.FeedUrl = ""
+        }
+        e.FeedName = i.Origin.Title
+        e.FeedHtmlUrl = i.Origin.HtmlUrl
+
+        entries = append(entries, e)
+    }
+    return
+}
+
+
+/*
+Parse Netscape bookmark file exported by browsers, Pocket, Pinboard etc. Folders containing a bookmark and
+the TAGS attribute become tags, <DD> after a bookmark is its description.
+
+The file is HTML but not well-formed (e.g. <DT> and <p> are not closed), so it's parsed by a non-strict xml decoder.
+*/
+func parseBookmarks(r io.Reader) (entries []*starredEntry, err error) {
+    decoder := xml.NewDecoder(r)
+    decoder.Strict = false
+    decoder.AutoClose = xml.HTMLAutoClose
+    decoder.Entity = xml.HTMLEntity
+    decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+        return input, nil
+    }
+
+    var folders []string        // names of folders containing current position
+    var folder string           // name of the folder whose <DL> is coming
+    var text *string            // where character data goes: title of folder or bookmark, or description
+    var last *starredEntry      // last bookmark, <DD> is its description
+    found := false
+
+    for {
+        token, e := decoder.Token()
+        if e == io.EOF {
+            break
+        }
+        // elements like <DT> are never closed, so the decoder reports unexpected EOF at the end of file.
+        if se, ok := e.(*xml.SyntaxError); ok && se.Msg == "unexpected EOF" {
+            break
+        }
+        if e != nil {
+            err = e
+            return
+        }
+
+        switch t := token.(type) {
+            case xml.StartElement:
+                // other elements like <b> are inline elements of title or description, they don't change text.
+                switch strings.ToLower(t.Name.Local) {
+                    case "dt", "hr":
+                        text = nil
+                    case "dl":
+                        text = nil
+                        found = true
+                        folders = append(folders, folder)
+                        folder = ""
+                    case "h3":
+                        folder = ""
+                        text = &folder
+                    case "a":
+                        e := new(starredEntry)
+                        for _, attr := range t.Attr {
+                            switch strings.ToLower(attr.Name.Local) {
+                                case "href":
+                                    e.Url = strings.TrimSpace(attr.Value)
+                                case "add_date":
+                                    if i, er := strconv.ParseInt(attr.Value, 10, 64); er == nil && i > 0 {
+                                        e.PubTime = time.Unix(i, 0)
+                                    }
+                                case "tags":
+                                    e.Tags = append(e.Tags, strings.Split(attr.Value, ",")...)
+                            }
+                        }
+                        for _, f := range folders {
+                            if f != "" {
+                                e.Tags = append(e.Tags, f)
+                            }
+                        }
+                        e.Guid = e.Url
+                        entries = append(entries, e)
+                        last = e
+                        text = &e.Title
+                    case "dd":
+                        text = nil
+                        if last != nil {
+                            text = &last.Content
+                        }
+                }
+
+            case xml.EndElement:
+                switch strings.ToLower(t.Name.Local) {
+                    case "dl":
+                        text = nil
+                        if len(folders) > 0 {
+                            folders = folders[:len(folders) - 1]
+                        }
+                    case "a", "h3":
+                        text = nil
+                }
+
+            case xml.CharData:
+                if text != nil {
+                    *text += string(t)
+                }
+        }
+    }
+
+    if !found {
+        err = fmt.Errorf("Bookmark list (<DL>) is not found.")
+        return
+    }
+
+    // description is plain text
+    for _, e := range entries {
+        e.Content = html.EscapeString(strings.TrimSpace(e.Content))
+    }
+    return
+}
+
+
+func isHttpUrl(s string) bool {
+    u, err := url.Parse(s)
+    return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+
+/*
+Get id of the feed for starred articles from feedUrl. If the feed is not subscribed, it's created in session
+without fetching, and its updating is paused (Feed.Interval is -1), user could resume it in feed settings.
+If feedUrl is empty, the synthetic feed StarredImportFeedUrl is used.
+*/
+func starredFeed(session *xorm.Session, feedUrl, name, htmlUrl string) (id int64, created bool, err error) {
+    if feedUrl == "" {
+        feedUrl = StarredImportFeedUrl
+        name = "Imported starred articles"
+        htmlUrl = ""
+    }
+
+    f := new(Feed)
+    ok, err := session.Cols("Id").Where("FeedUrl = ?", feedUrl).Get(f)
+    if err != nil {
+        return
+    }
+    if ok {
+        id = f.Id
+        return
+    }
+
+    if strings.TrimSpace(name) == "" {
+        name = feedUrl
+    }
+    feed := &Feed{
+        Name:       name,
+        FeedUrl:    feedUrl,
+        Url:        htmlUrl,
+        Type:       "rss",
+    }
+    id, _, err = subscribe(session, feed, nil, nil)
+    if err != nil {
+        return
+    }
+    created = true
+
+    _, err = session.Exec("update Feed set Interval = -1 where Id = ?", id)
+    return
+}
+
+
+/*
+Insert a starred article. If it already exists (same Guid in the feed, or same Url in any feed), it's marked as starred.
+Tags of new articles are saved as item tags. New articles are marked as read, they are history.
+*/
+func importStarredEntry(session *xorm.Session, fid int64, e *starredEntry) (added bool, err error) {
+    existing := new(Item)
+    ok, err := session.Cols("Id").Where("(Fid = ? and Guid = ?) or Url = ?", fid, e.Guid, e.Url).Get(existing)
+    if err != nil {
+        return
+    }
+    if ok {
+        _, err = session.Exec("update Item set Starred = 1 where Id = ?", existing.Id)
+        return
+    }
+
+    item := &Item{
+        Fid:        fid,
+        Author:     strings.TrimSpace(e.Author),
+        Url:        e.Url,
+        Guid:       e.Guid,
+        Title:      strings.TrimSpace(e.Title),
+        Content:    strings.TrimSpace(e.Content),
+        PubTime:    e.PubTime,
+        FetchTime:  time.Now(),
+        Starred:    true,
+        Read:       true,
+    }
+    if item.Title == "" {
+        item.Title = item.Url
+    }
+    if item.PubTime.IsZero() {
+        item.PubTime = item.FetchTime
+    }
+
+    h := md5.New()
+    fmt.Fprint(h, item.Content)
+    item.Hash = fmt.Sprintf("%x", h.Sum(nil))
+
+    _, err = session.Insert(item)
+    if err != nil {
+        return
+    }
+    added = true
+
+    err = saveItemTags(session, item.Id, trimTags(e.Tags))
+    return
+}
+
+
+/*
+Import starred articles exported by other readers. Formats are detected by content:
+
+    starred.json        Google Reader style JSON, exported by FreshRSS, Inoreader, The Old Reader etc.
+    bookmarks           Netscape bookmark file (HTML), exported by browsers, Pocket, Pinboard etc.
+
+Articles are saved as starred and read. An article is placed in its feed if the feed url is known (starred.json),
+the feed is created if it's not subscribed; otherwise it's placed in the synthetic feed StarredImportFeedUrl.
+Articles already exist (by Fid + Guid, or by Url in any feed) are not duplicated, but marked as starred.
+Feeds and articles are imported in one transaction, if an error occurs, nothing is imported.
+If the file cannot be parsed, err is *ImportDataError; entries without a http url are rejected.
+*/
+func ImportStarred(r io.Reader) (result StarredImportResult, err error) {
+    br := bufio.NewReader(r)
+
+    // skip byte order mark of utf-8
+    if b, e := br.Peek(3); e == nil && bytes.Equal(b, []byte("\xef\xbb\xbf")) {
+        br.Discard(3)
+    }
+
+    // the first non-space character decides the format
+    var first byte
+    for {
+        first, err = br.ReadByte()
+        if err == io.EOF {
+            err = &ImportDataError{1, "Data is empty."}
+            return
+        }
+        if err != nil {
+            return
+        }
+        if !strings.ContainsRune(" \t\r\n", rune(first)) {
+            break
+        }
+    }
+    br.UnreadByte()
+
+    var entries []*starredEntry
+    if first == '{' {
+        result.Format = "starred.json"
+        entries, err = parseStarredJson(br)
+    } else {
+        result.Format = "bookmarks"
+        entries, err = parseBookmarks(br)
+    }
+    if err != nil {
+        err = &ImportDataError{1, fmt.Sprintf("Cannot parse %s file: %s", result.Format, err.Error())}
+        return
+    }
+
+    // feed url => Feed.Id
+    fids := make(map[string]int64)
+
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+
+    for _, e := range entries {
+        e.Url = strings.TrimSpace(e.Url)
+        if !isHttpUrl(e.Url) {
+            result.reject("'%s' (%s) is not a http url.", e.Url, strings.TrimSpace(e.Title))
+            continue
+        }
+        if strings.TrimSpace(e.Guid) == "" {
+            e.Guid = e.Url
+        }
+
+        if _, ok := fids[e.FeedUrl]; !ok {
+            id, created, er := starredFeed(session, e.FeedUrl, e.FeedName, e.FeedHtmlUrl)
+            if er != nil {
+                session.Rollback()
+                err = er
+                return
+            }
+            fids[e.FeedUrl] = id
+            if created {
+                result.Feeds++
+            }
+        }
+
+        added, er := importStarredEntry(session, fids[e.FeedUrl], e)
+        if er != nil {
+            session.Rollback()
+            err = er
+            return
+        }
+        if added {
+            result.Imported++
+        } else {
+            result.Duplicated++
+        }
+    }
+
+    err = session.Commit()
+    if err != nil {
+        session.Rollback()
+    }
+    return
+}
@@ -0,0 +1,176 @@
+package model
+
+import "bytes"
+import "encoding/json"
+import "fmt"
+import "html"
+import "mime"
+import "strings"
+import "time"
+import "github.com/m3ng9i/feedreader"
+
+
+// Map to a JSON Feed document, version 1.0 and 1.1 are supported. See https://jsonfeed.org/version/1.1
+type jsonFeed struct {
+    Version         string              `json:"version"`
+    Title           string              `json:"title"`
+    HomePageUrl     string              `json:"home_page_url"`
+    FeedUrl         string              `json:"feed_url"`
+    Description     string              `json:"description"`
+    Authors         []jsonFeedAuthor    `json:"authors"`        // 1.1
+    Author          *jsonFeedAuthor     `json:"author"`         // 1.0, deprecated in 1.1
+    Items           []jsonFeedItem      `json:"items"`
+}
+
+
+type jsonFeedAuthor struct {
+    Name            string              `json:"name"`
+    Url             string              `json:"url"`
+}
+
+
+type jsonFeedItem struct {
+    Id              json.RawMessage     `json:"id"`             // should be a string, but some feeds use numbers
+    Url             string              `json:"url"`
+    ExternalUrl     string              `json:"external_url"`
+    Title           string              `json:"title"`
+    ContentHtml     string              `json:"content_html"`
+    ContentText     string              `json:"content_text"`
+    Summary         string              `json:"summary"`
+    DatePublished   string              `json:"date_published"` // RFC 3339
+    DateModified    string              `json:"date_modified"`
+    Authors         []jsonFeedAuthor    `json:"authors"`
+    Author          *jsonFeedAuthor     `json:"author"`
+}
+
+
+// Get the first author's name of authors (1.1) or author (1.0).
+func jsonFeedAuthorName(authors []jsonFeedAuthor, author *jsonFeedAuthor) string {
+    for _, a := range authors {
+        if a.Name != "" {
+            return a.Name
+        }
+    }
+    if author != nil {
+        return author.Name
+    }
+    return ""
+}
+
+
+func jsonFeedTime(s string) time.Time {
+    t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+    if err != nil {
+        return time.Time{}
+    }
+    return t
+}
+
+
+// Convert plain text to html: escape it and keep line breaks.
+func textToHtml(s string) string {
+    s = html.EscapeString(strings.TrimSpace(s))
+    return strings.Replace(s, "\n", "<br>\n", -1)
+}
+
+
+/*
+Parse a JSON Feed document into the same structure as feedreader does, so it could be assembled by assembleFeed().
+feedLink is the url of the document, Feed.Type is "json".
+*/
+func parseJsonFeed(doc []byte, feedLink string) (fd *feedreader.Feed, err error) {
+    var f jsonFeed
+    err = json.Unmarshal(bytes.TrimPrefix(doc, []byte("\xef\xbb\xbf")), &f)
+    if err != nil {
+        err = &FeedParseError{feedLink, "JSON Feed", err}
+        return
+    }
+    if !strings.HasPrefix(f.Version, "https://jsonfeed.org/version/") {
+        err = &FeedParseError{feedLink, "JSON Feed", fmt.Errorf("version '%s' is not a JSON Feed version", f.Version)}
+        return
+    }
+
+    fd = new(feedreader.Feed)
+    fd.Type         = "json"
+    fd.Title        = f.Title
+    fd.Link         = f.HomePageUrl
+    fd.FeedLink     = feedLink
+    fd.Description  = f.Description
+
+    feedAuthor := jsonFeedAuthorName(f.Authors, f.Author)
+
+    for _, i := range f.Items {
+        item := new(feedreader.FeedItem)
+
+        // id is a string or a number
+        var id string
+        if json.Unmarshal(i.Id, &id) != nil {
+            id = strings.TrimSpace(string(i.Id))
+        }
+
+        item.Link = i.Url
+        if item.Link == "" {
+            item.Link = i.ExternalUrl
+        }
+        item.Guid = id
+
+        item.Title = i.Title
+        if item.Title == "" {
+            item.Title = i.Summary
+        }
+
+        item.Summary = i.Summary
+        switch {
+            case i.ContentHtml != "":
+                item.Content = i.ContentHtml
+            case i.ContentText != "":
+                item.Content = textToHtml(i.ContentText)
+            default:
+                item.Content = textToHtml(i.Summary)
+        }
+
+        if name := jsonFeedAuthorName(i.Authors, i.Author); name != "" {
+            item.Author = &feedreader.FeedPerson{Name: name}
+        } else if feedAuthor != "" {
+            item.Author = &feedreader.FeedPerson{Name: feedAuthor}
+        }
+
+        item.PubDate = jsonFeedTime(i.DatePublished)
+        item.Updated = jsonFeedTime(i.DateModified)
+
+        fd.Items = append(fd.Items, item)
+    }
+    return
+}
+
+
+/*
+Check if a document is a JSON Feed by the content type of response (application/feed+json or application/json),
+or by sniffing the document: a JSON document starts with "{".
+*/
+func isJsonFeed(contentType string, doc []byte) bool {
+    if t, _, err := mime.ParseMediaType(contentType); err == nil {
+        if t == "application/feed+json" || t == "application/json" {
+            return true
+        }
+    }
+
+    doc = bytes.TrimPrefix(doc, []byte("\xef\xbb\xbf"))
+    doc = bytes.TrimSpace(doc)
+    return len(doc) > 0 && doc[0] == '{'
+}
+
+
+/*
+Parse a feed document of RSS, Atom or JSON Feed. contentType is the Content-Type header of response, it could be empty.
+RSS 2.0 and Atom are parsed by feedreader, legacy RSS (RSS 1.0, 0.90 and 0.9x) by parseLegacyRss().
+*/
+func parseFeedDoc(doc []byte, contentType, feedLink string) (*feedreader.Feed, error) {
+    if isJsonFeed(contentType, doc) {
+        return parseJsonFeed(doc, feedLink)
+    }
+    if dialect := legacyRssDialect(doc); dialect != "" {
+        return parseLegacyRss(doc, dialect, feedLink)
+    }
+    return feedreader.Parse(bytes.NewReader(doc), feedLink)
+}
@@ -0,0 +1,153 @@
+package model
+
+import "testing"
+import "time"
+
+
+type jsonFeedWant struct {
+    title   string
+    url     string
+    guid    string
+    author  string
+    content string
+    pubTime time.Time
+}
+
+
+func testJsonFeed(t *testing.T, fixture, contentType, feedName, feedUrl string, want []jsonFeedWant) {
+    doc := readFixture(t, fixture)
+
+    fd, err := parseFeedDoc(doc, contentType, "http://example.com/feed.json")
+    if err != nil {
+        t.Fatalf("parse %s: %s", fixture, err.Error())
+    }
+
+    feed, items := assembleFeed(fd)
+    if feed.Type != "json" || feed.Name != feedName || feed.Url != feedUrl || feed.FeedUrl != "http://example.com/feed.json" {
+        t.Errorf("feed of %s: got type '%s', name '%s', url '%s', feed url '%s'",
+            fixture, feed.Type, feed.Name, feed.Url, feed.FeedUrl)
+    }
+
+    if len(items) != len(want) {
+        t.Fatalf("items of %s: got %d, want %d", fixture, len(items), len(want))
+    }
+
+    for i, w := range want {
+        item := items[i]
+        if item.Title != w.title {
+            t.Errorf("%s item %d title: got '%s', want '%s'", fixture, i, item.Title, w.title)
+        }
+        if item.Url != w.url {
+            t.Errorf("%s item %d url: got '%s', want '%s'", fixture, i, item.Url, w.url)
+        }
+        if item.Guid != w.guid {
+            t.Errorf("%s item %d guid: got '%s', want '%s'", fixture, i, item.Guid, w.guid)
+        }
+        if item.Author != w.author {
+            t.Errorf("%s item %d author: got '%s', want '%s'", fixture, i, item.Author, w.author)
+        }
+        if item.Content != w.content {
+            t.Errorf("%s item %d content: got '%s', want '%s'", fixture, i, item.Content, w.content)
+        }
+        if !item.PubTime.Equal(w.pubTime) {
+            t.Errorf("%s item %d pubtime: got %s, want %s", fixture, i, item.PubTime, w.pubTime)
+        }
+    }
+}
+
+
+// JSON Feed 1.0: numeric id, "author" of the feed, content_text and external_url.
+func TestJsonFeed10(t *testing.T) {
+    want := []jsonFeedWant{
+        {
+            title:      "A numeric id",
+            url:        "https://blog.example.com/posts/1001",
+            guid:       "1001",
+            author:     "Carol",
+            content:    "<p>Hello <b>world</b></p>",
+            pubTime:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+        },
+        {
+            title:      "Plain text",
+            url:        "https://other.example.com/article",
+            guid:       "https://blog.example.com/posts/link",
+            author:     "Dave",
+            content:    "Tom &amp; Jerry &lt;3<br>\nSecond line",
+            pubTime:    time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC),
+        },
+    }
+
+    testJsonFeed(t, "jsonfeed10.json", "application/feed+json", "Example Blog", "https://blog.example.com/", want)
+
+    // served without Content-Type, the document is sniffed
+    testJsonFeed(t, "jsonfeed10.json", "", "Example Blog", "https://blog.example.com/", want)
+}
+
+
+// JSON Feed 1.1: "authors" of the feed and items, an item without id and title, and a document starts with BOM.
+func TestJsonFeed11(t *testing.T) {
+    first := time.Date(2026, 9, 25, 10, 0, 0, 0, time.UTC)
+    want := []jsonFeedWant{
+        {
+            title:      "Episode 2",
+            url:        "https://podcast.example.com/2",
+            guid:       "ep-2",
+            author:     "Frank",
+            content:    "<p>Show notes</p>",
+            pubTime:    time.Date(2026, 10, 2, 10, 0, 0, 0, time.UTC),
+        },
+        {
+            title:      "The first episode",
+            url:        "https://podcast.example.com/1",
+            guid:       fallbackGuid("https://podcast.example.com/1", "The first episode", first),
+            author:     "Erin",
+            content:    "The first episode",
+            pubTime:    first,
+        },
+    }
+
+    testJsonFeed(t, "jsonfeed11.json", "text/plain; charset=utf-8", "Example Podcast", "https://podcast.example.com/", want)
+}
+
+
+func TestIsJsonFeed(t *testing.T) {
+    tests := []struct {
+        contentType string
+        doc         string
+        want        bool
+    }{
+        {"application/feed+json", "", true},
+        {"application/json; charset=utf-8", "", true},
+        {"", `{"version": "https://jsonfeed.org/version/1.1"}`, true},
+        {"text/plain", "\xef\xbb\xbf\n  {}", true},
+        {"text/html", "  {", true},
+        {"", `<?xml version="1.0"?><rss version="2.0"></rss>`, false},
+        {"application/rss+xml", "<rss></rss>", false},
+        {"application/feed+json; charset", "<rss></rss>", false},
+        {"", "", false},
+        {"", "\xef\xbb\xbf", false},
+    }
+
+    for _, test := range tests {
+        if got := isJsonFeed(test.contentType, []byte(test.doc)); got != test.want {
+            t.Errorf("content type '%s', document '%s': got %v, want %v", test.contentType, test.doc, got, test.want)
+        }
+    }
+}
+
+
+func TestParseJsonFeedError(t *testing.T) {
+    docs := []string{
+        `{"version": "1.0", "items": []}`,
+        `{"title": "no version"}`,
+        `{"version": "https://jsonfeed.org/version/1", "items": [}`,
+        `[]`,
+    }
+
+    for _, doc := range docs {
+        _, err := parseFeedDoc([]byte(doc), "application/feed+json", "http://example.com/feed.json")
+        if _, ok := err.(*FeedParseError); !ok {
+            t.Errorf("%s: got error %v, want FeedParseError", doc, err)
+        }
+    }
+}
@@ -0,0 +1,247 @@
+package model
+
+import "bytes"
+import "encoding/xml"
+import "fmt"
+import "io"
+import "io/ioutil"
+import "strings"
+import "time"
+import "github.com/m3ng9i/feedreader"
+
+
+// Namespaces used to detect RSS 0.90 and RSS 1.0.
+const nsRdf         = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+const nsRss090      = "http://my.netscape.com/rdf/simple/0.9/"
+const nsRss10       = "http://purl.org/rss/1.0/"
+
+
+/*
+Map to RSS 1.0 (RDF), RSS 0.90 (RDF) and RSS 0.91-0.94 documents.
+
+In RDF dialects, items are siblings of <channel> under <rdf:RDF>, in RSS 0.9x items are children of <channel>.
+Dublin Core elements (dc:date, dc:creator) are used by RSS 1.0, and also seen in RSS 0.9x.
+*/
+type legacyRss struct {
+    XMLName     xml.Name
+    Channel     legacyRssChannel    `xml:"channel"`
+    Items       []*legacyRssItem    `xml:"item"`              // RDF only
+}
+
+
+type legacyRssChannel struct {
+    Title       string              `xml:"title"`
+    Link        string              `xml:"link"`
+    Description string              `xml:"description"`
+    Items       []*legacyRssItem    `xml:"item"`              // RSS 0.9x only
+}
+
+
+type legacyRssItem struct {
+    About       string              `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+    Title       string              `xml:"title"`
+    Link        string              `xml:"link"`
+    Description string              `xml:"description"`
+    Guid        string              `xml:"guid"`
+    PubDate     string              `xml:"pubDate"`
+    Author      string              `xml:"author"`
+    Encoded     string              `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+    Creators    []string            `xml:"http://purl.org/dc/elements/1.1/ creator"`
+    Date        string              `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+
+// Windows-1252 characters of bytes 0x80-0x9f, other bytes are the same as ISO-8859-1. 0 means undefined.
+var windows1252 = [32]rune{
+    0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021, 0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+    0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014, 0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+
+/*
+Charset reader for legacy feeds, which are often encoded in ISO-8859-1 or Windows-1252.
+UTF-8 and US-ASCII documents are read as is.
+*/
+func legacyCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+    switch strings.ToLower(strings.TrimSpace(charset)) {
+        case "", "utf-8", "utf8", "us-ascii", "ascii":
+            return input, nil
+
+        case "iso-8859-1", "iso8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+            b, err := ioutil.ReadAll(input)
+            if err != nil {
+                return nil, err
+            }
+            runes := make([]rune, len(b))
+            for i, c := range b {
+                runes[i] = rune(c)
+                if c >= 0x80 && c <= 0x9f && windows1252[c - 0x80] != 0 {
+                    runes[i] = windows1252[c - 0x80]
+                }
+            }
+            return strings.NewReader(string(runes)), nil
+    }
+    return nil, fmt.Errorf("charset '%s' is not supported", charset)
+}
+
+
+/*
+Get the dialect of a legacy RSS document by its root element: "RSS 1.0", "RSS 0.90" or "RSS 0.9x" (0.91-0.94).
+If the document is not a legacy RSS (e.g. RSS 2.0 or Atom, which are parsed by feedreader), dialect is empty.
+*/
+func legacyRssDialect(doc []byte) (dialect string) {
+    decoder := xml.NewDecoder(bytes.NewReader(doc))
+    decoder.Strict = false
+    decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+        return input, nil
+    }
+
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            return
+        }
+
+        t, ok := token.(xml.StartElement)
+        if !ok {
+            continue
+        }
+
+        switch {
+            case t.Name.Space == nsRdf && t.Name.Local == "RDF":
+                for _, attr := range t.Attr {
+                    if attr.Name.Space == "xmlns" || attr.Name.Local != "xmlns" {
+                        continue
+                    }
+                    switch attr.Value {
+                        case nsRss090:
+                            return "RSS 0.90"
+                        case nsRss10:
+                            return "RSS 1.0"
+                    }
+                }
+                // channel and items may be prefixed instead of in the default namespace
+                if bytes.Contains(doc, []byte(nsRss090)) {
+                    return "RSS 0.90"
+                }
+                return "RSS 1.0"
+
+            case t.Name.Local == "rss":
+                for _, attr := range t.Attr {
+                    if attr.Name.Local == "version" && strings.HasPrefix(strings.TrimSpace(attr.Value), "0.9") {
+                        return "RSS 0.9x"
+                    }
+                }
+        }
+        return
+    }
+}
+
+
+// Parse a date of Dublin Core (W3C-DTF, a profile of ISO 8601) or RSS (RFC 822), return zero time if it's not a date.
+func parseLegacyDate(s string) time.Time {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return time.Time{}
+    }
+
+    layouts := []string{
+        time.RFC3339Nano,
+        "2006-01-02T15:04Z07:00",
+        "2006-01-02T15:04:05",
+        "2006-01-02",
+        "2006-01",
+        time.RFC1123Z,
+        time.RFC1123,
+        "Mon, 2 Jan 2006 15:04:05 -0700",
+        "Mon, 2 Jan 2006 15:04:05 MST",
+        "2 Jan 2006 15:04:05 -0700",
+        "2 Jan 2006 15:04:05 MST",
+        "Mon, 2 Jan 2006 15:04 -0700",
+        "Mon, 2 Jan 2006 15:04 MST",
+        time.RFC822Z,
+        time.RFC822,
+    }
+    for _, layout := range layouts {
+        if t, err := time.Parse(layout, s); err == nil {
+            return t
+        }
+    }
+    return time.Time{}
+}
+
+
+/*
+Parse a legacy RSS document (see legacyRssDialect()) into the same structure as feedreader does, so it could be
+assembled by assembleFeed(). Feed.Type is "rss".
+
+Item.Guid is rdf:about (RSS 1.0) or guid, if both are empty, assembleFeed() uses fallbackGuid(). Author is dc:creator or author, PubTime is dc:date or pubDate,
+Content is content:encoded or description.
+*/
+func parseLegacyRss(doc []byte, dialect, feedLink string) (fd *feedreader.Feed, err error) {
+    decoder := xml.NewDecoder(bytes.NewReader(doc))
+    decoder.Strict = false
+    decoder.Entity = xml.HTMLEntity
+    decoder.CharsetReader = legacyCharsetReader
+
+    var rss legacyRss
+    err = decoder.Decode(&rss)
+    if err != nil {
+        err = &FeedParseError{feedLink, dialect, err}
+        return
+    }
+
+    items := rss.Items
+    if len(items) == 0 {
+        items = rss.Channel.Items
+    }
+
+    fd = new(feedreader.Feed)
+    fd.Type         = "rss"
+    fd.Title        = strings.TrimSpace(rss.Channel.Title)
+    fd.Link         = strings.TrimSpace(rss.Channel.Link)
+    fd.FeedLink     = feedLink
+    fd.Description  = strings.TrimSpace(rss.Channel.Description)
+
+    for _, i := range items {
+        item := new(feedreader.FeedItem)
+        item.Title  = strings.TrimSpace(i.Title)
+        item.Link   = strings.TrimSpace(i.Link)
+
+        item.Guid = strings.TrimSpace(i.About)
+        if item.Guid == "" {
+            item.Guid = strings.TrimSpace(i.Guid)
+        }
+        if item.Link == "" && (strings.HasPrefix(item.Guid, "http://") || strings.HasPrefix(item.Guid, "https://")) {
+            item.Link = item.Guid
+        }
+
+        item.Summary = strings.TrimSpace(i.Description)
+        item.Content = strings.TrimSpace(i.Encoded)
+        if item.Content == "" {
+            item.Content = item.Summary
+        }
+
+        var creators []string
+        for _, c := range i.Creators {
+            if c = strings.TrimSpace(c); c != "" {
+                creators = append(creators, c)
+            }
+        }
+        author := strings.Join(creators, ", ")
+        if author == "" {
+            author = strings.TrimSpace(i.Author)
+        }
+        if author != "" {
+            item.Author = &feedreader.FeedPerson{Name: author}
+        }
+
+        item.PubDate = parseLegacyDate(i.Date)
+        if item.PubDate.IsZero() {
+            item.PubDate = parseLegacyDate(i.PubDate)
+        }
+
+        fd.Items = append(fd.Items, item)
+    }
+    return
+}
@@ -0,0 +1,159 @@
+package model
+
+import "io/ioutil"
+import "path/filepath"
+import "testing"
+import "time"
+
+
+func readFixture(t *testing.T, name string) []byte {
+    doc, err := ioutil.ReadFile(filepath.Join("testdata", name))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return doc
+}
+
+
+type legacyRssWant struct {
+    title   string
+    url     string
+    guid    string
+    author  string
+    content string
+    pubTime time.Time
+}
+
+
+func testLegacyRss(t *testing.T, fixture, dialect, feedName, feedUrl string, want []legacyRssWant) {
+    doc := readFixture(t, fixture)
+
+    if d := legacyRssDialect(doc); d != dialect {
+        t.Fatalf("dialect of %s: got '%s', want '%s'", fixture, d, dialect)
+    }
+
+    fd, err := parseFeedDoc(doc, "text/xml", "http://example.com/feed")
+    if err != nil {
+        t.Fatalf("parse %s: %s", fixture, err.Error())
+    }
+
+    feed, items := assembleFeed(fd)
+    if feed.Type != "rss" || feed.Name != feedName || feed.Url != feedUrl || feed.FeedUrl != "http://example.com/feed" {
+        t.Errorf("feed of %s: got type '%s', name '%s', url '%s', feed url '%s'",
+            fixture, feed.Type, feed.Name, feed.Url, feed.FeedUrl)
+    }
+
+    if len(items) != len(want) {
+        t.Fatalf("items of %s: got %d, want %d", fixture, len(items), len(want))
+    }
+
+    for i, w := range want {
+        item := items[i]
+        if item.Title != w.title {
+            t.Errorf("%s item %d title: got '%s', want '%s'", fixture, i, item.Title, w.title)
+        }
+        if item.Url != w.url {
+            t.Errorf("%s item %d url: got '%s', want '%s'", fixture, i, item.Url, w.url)
+        }
+        if item.Guid != w.guid {
+            t.Errorf("%s item %d guid: got '%s', want '%s'", fixture, i, item.Guid, w.guid)
+        }
+        if item.Author != w.author {
+            t.Errorf("%s item %d author: got '%s', want '%s'", fixture, i, item.Author, w.author)
+        }
+        if item.Content != w.content {
+            t.Errorf("%s item %d content: got '%s', want '%s'", fixture, i, item.Content, w.content)
+        }
+        if !item.PubTime.Equal(w.pubTime) {
+            t.Errorf("%s item %d pubtime: got %s, want %s", fixture, i, item.PubTime, w.pubTime)
+        }
+        if item.Hash == "" {
+            t.Errorf("%s item %d: hash is empty", fixture, i)
+        }
+    }
+}
+
+
+func TestRss10(t *testing.T) {
+    testLegacyRss(t, "rss10.xml", "RSS 1.0", "Journal of Examples", "http://journal.example.org/", []legacyRssWant{
+        {
+            title:      "On the Nature of Examples",
+            url:        "http://journal.example.org/article/1?from=rss",
+            guid:       "http://journal.example.org/article/1",
+            author:     "Alice Smith, Bob Jones",
+            content:    "<p>Full text of the article.</p>",
+            pubTime:    time.Date(2026, 10, 1, 2, 30, 0, 0, time.UTC),
+        },
+        {
+            title:      "A Short Note",
+            url:        "http://journal.example.org/article/2",
+            guid:       "http://journal.example.org/article/2",
+            content:    "Only a description.",
+            pubTime:    time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC),
+        },
+    })
+}
+
+
+func TestRss090(t *testing.T) {
+    testLegacyRss(t, "rss090.xml", "RSS 0.90", "Mozilla Dot Org", "http://www.mozilla.org", []legacyRssWant{
+        {
+            title:      "New Status Updates",
+            url:        "http://www.mozilla.org/status/",
+            guid:       fallbackGuid("http://www.mozilla.org/status/", "New Status Updates", time.Time{}),
+        },
+        {
+            title:      "Bugzilla Reorganized",
+            url:        "http://www.mozilla.org/bugs/",
+            guid:       fallbackGuid("http://www.mozilla.org/bugs/", "Bugzilla Reorganized", time.Time{}),
+        },
+    })
+}
+
+
+func TestRss091(t *testing.T) {
+    testLegacyRss(t, "rss091.xml", "RSS 0.9x", "Agence Exemple", "http://agence.example.gov/", []legacyRssWant{
+        {
+            title:      "Résultats “annuels”",
+            url:        "http://agence.example.gov/communiques/42",
+            guid:       fallbackGuid("http://agence.example.gov/communiques/42", "Résultats “annuels”", time.Time{}),
+            content:    "Le rapport annuel est publié\u00a0aujourd'hui.",
+        },
+    })
+}
+
+
+func TestRss092(t *testing.T) {
+    testLegacyRss(t, "rss092.xml", "RSS 0.9x", "Department News", "http://dept.example.gov/", []legacyRssWant{
+        {
+            title:      "Office closure",
+            url:        "http://dept.example.gov/news/closure",
+            guid:       fallbackGuid("http://dept.example.gov/news/closure", "Office closure", time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)),
+            author:     "press@dept.example.gov",
+            content:    "The office will be closed on Friday.",
+            pubTime:    time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC),
+        },
+        {
+            title:      "New forms",
+            url:        "http://dept.example.gov/news/forms",
+            guid:       fallbackGuid("http://dept.example.gov/news/forms", "New forms", time.Date(2026, 9, 29, 19, 0, 0, 0, time.UTC)),
+            author:     "Press Office",
+            content:    "New forms are available.",
+            pubTime:    time.Date(2026, 9, 29, 19, 0, 0, 0, time.UTC),
+        },
+    })
+}
+
+
+// RSS 2.0 and Atom are left to feedreader.
+func TestLegacyRssDialectOfModernFeeds(t *testing.T) {
+    docs := []string{
+        `<?xml version="1.0"?><rss version="2.0"><channel><title>x</title></channel></rss>`,
+        `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>x</title></feed>`,
+    }
+    for _, doc := range docs {
+        if d := legacyRssDialect([]byte(doc)); d != "" {
+            t.Errorf("dialect of %s: got '%s', want ''", doc, d)
+        }
+    }
+}
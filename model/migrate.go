@@ -0,0 +1,406 @@
+package model
+
+import "fmt"
+import "strings"
+import "time"
+import dbsql "database/sql"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+/*
+A step of database schema change. Migrations are run in order of Version, each in a transaction,
+and the version is recorded in table SchemaMigration after the migration is done.
+
+Databases created by QReader before migrations were introduced have no SchemaMigration table,
+all the migrations will be run on them, so migrations should not fail if the change has been made
+(e.g. use "create table if not exists", and addColumn() which skips existing columns).
+
+Never change or remove a migration after it's released, add a new one instead.
+*/
+type migration struct {
+    Version     int
+    Name        string
+    Up          func(session *xorm.Session) error
+}
+
+
+const createSchemaMigrationSql = `
+create table if not exists 'SchemaMigration' (
+    'Version'           integer not null primary key,                   -- version of migration
+    'Name'              text not null,                                  -- name of migration
+    'AppliedTime'       datetime not null                               -- time of the migration is run
+)`
+
+
+// Execute sql statements separated by ';'. Statements should not contain ';' (e.g. create trigger).
+func execSql(session *xorm.Session, sql string) (err error) {
+    for _, s := range strings.Split(sql, ";") {
+        if strings.TrimSpace(s) == "" {
+            continue
+        }
+        _, err = session.Exec(s)
+        if err != nil {
+            return
+        }
+    }
+    return
+}
+
+
+// Add a column to a table if it does not exist.
+func addColumn(session *xorm.Session, table, column, definition string) (err error) {
+    results, err := session.Query(fmt.Sprintf("pragma table_info('%s')", table))
+    if err != nil {
+        return
+    }
+    for _, r := range results {
+        if strings.EqualFold(string(r["name"]), column) {
+            return
+        }
+    }
+
+    _, err = session.Exec(fmt.Sprintf("alter table '%s' add column '%s' %s", table, column, definition))
+    return
+}
+
+
+// Migrations of database schema, in order of version.
+var migrations = []migration {
+    {1, "create tables of the first release", func(session *xorm.Session) error {
+        return execSql(session, `
+            create table if not exists 'Feed' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Name'              text not null,                                  -- name of feed
+                'Alias'             text not null default '',                       -- feed name's alias
+                'Feedurl'           text not null,                                  -- url of feed
+                'Url'               text not null,                                  -- url the feed point to
+                'Desc'              text not null default '',                       -- feed description
+                'Type'              text not null,                                  -- feed type: rss or atom
+                'Interval'          integer not null default 0,                     -- refresh interval (minute), 0 for default interval. value below zero means not update.
+                'LastFetch'         datetime not null,                              -- last successful fetch time (timestamp)
+                'LastFailed'        datetime not null,                              -- last failed time for fetching (timestamp)
+                'LastError'         text not null default '',                       -- last error for fetching
+                'MaxUnread'         integer not null default 0,                     -- max number of unread items. 0 for keep all.
+                'MaxKeep'           integer not null default 0,                     -- max number of items to keep. 0 for keep all, greater than 0 for keep n unread items.
+                'Filter'            text not null default '',                       -- filter rules
+                'UseProxy'          integer not null default 0,                     -- whether to use proxy to fetch feed. 0: try, 1: always, 2: never.
+                'Note'              text not null default ''                        -- comments for this feed (not to use now)
+            );
+
+            create table if not exists 'Item' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Fid'               integer not null,                               -- Feed.id
+                'Author'            text not null,                                  -- author
+                'Url'               text not null,                                  -- url of the item
+                'Guid'              text not null,                                  -- guid of the item
+                'Title'             text not null,                                  -- title
+                'Content'           text not null,                                  -- content
+                'PubTime'           datetime not null,                              -- item pubtime
+                'FetchTime'         datetime not null,                              -- item fetch time
+                'Starred'           integer not null default 0,                     -- whether the item was starred. 0:no, 1:yes.
+                'Read'              integer not null default 0,                     -- whether the item has been read. 0:no, 1:yes
+                'Hash'              text not null                                   -- md5sum of content
+            );
+
+            create table if not exists 'Tag' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Fid'               integer not null,                               -- Feed.id
+                'Name'              text collate nocase not null                    -- tag name, case insensitive
+            );
+
+            create unique index if not exists i_feed_url on Feed(Feedurl);
+            create unique index if not exists i_item_url on Item(Url);
+            create unique index if not exists i_item_combine_guid on Item(Fid, Guid);
+            create unique index if not exists i_tag_combine_name_fid on Tag(Name, Fid);
+        `)
+    }},
+
+    {2, "add columns of Feed for conditional fetching, backoff and suspending", func(session *xorm.Session) error {
+        columns := []struct {
+            Column      string
+            Definition  string
+        } {
+            {"ETag",            "text not null default ''"},                            // ETag header of last fetch
+            {"LastModified",    "text not null default ''"},                            // Last-Modified header of last fetch
+            {"FailCount",       "integer not null default 0"},                          // number of consecutive failed fetches
+            {"Suspended",       "integer not null default 0"},                          // whether the feed is suspended after too many consecutive failures
+            {"MinInterval",     "integer not null default 0"},                          // min refresh interval (minute) declared by the feed
+            {"SkipHours",       "text not null default ''"},                            // hours (GMT) the feed should not be fetched, comma separated
+            {"SkipDays",        "text not null default ''"},                            // days the feed should not be fetched, comma separated
+            {"RetryAfter",      "datetime not null default '0001-01-01 00:00:00'"},     // do not fetch before this time, from http header Retry-After
+        }
+        for _, c := range columns {
+            err := addColumn(session, "Feed", c.Column, c.Definition)
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    }},
+
+    {3, "create tables of global rules and item tags", func(session *xorm.Session) error {
+        return execSql(session, `
+            create table if not exists 'Rule' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Name'              text not null default '',                       -- rule name
+                'Condition'         text not null,                                  -- condition for matching items
+                'Action'            text not null,                                  -- actions for matched items, comma separated: read, star, tag:<name>
+                'Enabled'           integer not null default 1                      -- whether the rule is enabled. 0:no, 1:yes.
+            );
+
+            create table if not exists 'ItemTag' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Iid'               integer not null,                               -- Item.id
+                'Name'              text collate nocase not null                    -- tag name, case insensitive
+            );
+
+            create unique index if not exists i_itemtag_combine_name_iid on ItemTag(Name, Iid);
+        `)
+    }},
+
+    {4, "create table of saved searches", func(session *xorm.Session) error {
+        return execSql(session, `
+            create table if not exists 'SavedSearch' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Name'              text not null,                                  -- name of saved search
+                'Query'             text not null,                                  -- search query
+                'PageSize'          integer not null default 0                      -- default number of articles in a page, 0 for client's default
+            );
+        `)
+    }},
+
+    /*
+    SQLite cannot add foreign keys to existing tables, so Item, Tag and ItemTag are recreated, rows whose parent
+    does not exist are dropped. Feed is not recreated, so dropping the old tables does not cascade.
+    Triggers of full-text index on Item are dropped with the old table, initFts() will recreate them and rebuild the index.
+    */
+    {5, "add foreign keys and indexes", func(session *xorm.Session) error {
+        return execSql(session, `
+            create table 'Item_new' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Fid'               integer not null references Feed(Id) on delete cascade, -- Feed.id
+                'Author'            text not null,                                  -- author
+                'Url'               text not null,                                  -- url of the item
+                'Guid'              text not null,                                  -- guid of the item
+                'Title'             text not null,                                  -- title
+                'Content'           text not null,                                  -- content
+                'PubTime'           datetime not null,                              -- item pubtime
+                'FetchTime'         datetime not null,                              -- item fetch time
+                'Starred'           integer not null default 0,                     -- whether the item was starred. 0:no, 1:yes.
+                'Read'              integer not null default 0,                     -- whether the item has been read. 0:no, 1:yes
+                'Hash'              text not null                                   -- md5sum of content
+            );
+            insert into Item_new (Id, Fid, Author, Url, Guid, Title, Content, PubTime, FetchTime, Starred, Read, Hash)
+                select Id, Fid, Author, Url, Guid, Title, Content, PubTime, FetchTime, Starred, Read, Hash
+                from Item where Fid in (select Id from Feed);
+
+            -- keep the autoincrement sequence, so ids of deleted items are not reused, even if Item_new has no rows
+            delete from sqlite_sequence where name = 'Item_new';
+            insert into sqlite_sequence (name, seq) values ('Item_new', max(
+                ifnull((select max(seq) from sqlite_sequence where name = 'Item'), 0), ifnull((select max(Id) from Item_new), 0)));
+            drop table Item;
+            alter table Item_new rename to Item;
+
+            create table 'Tag_new' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Fid'               integer not null references Feed(Id) on delete cascade, -- Feed.id
+                'Name'              text collate nocase not null                    -- tag name, case insensitive
+            );
+            insert into Tag_new (Id, Fid, Name) select Id, Fid, Name from Tag where Fid in (select Id from Feed);
+            delete from sqlite_sequence where name = 'Tag_new';
+            insert into sqlite_sequence (name, seq) values ('Tag_new', max(
+                ifnull((select max(seq) from sqlite_sequence where name = 'Tag'), 0), ifnull((select max(Id) from Tag_new), 0)));
+            drop table Tag;
+            alter table Tag_new rename to Tag;
+
+            create table 'ItemTag_new' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Iid'               integer not null references Item(Id) on delete cascade, -- Item.id
+                'Name'              text collate nocase not null                    -- tag name, case insensitive
+            );
+            insert into ItemTag_new (Id, Iid, Name) select Id, Iid, Name from ItemTag where Iid in (select Id from Item);
+            delete from sqlite_sequence where name = 'ItemTag_new';
+            insert into sqlite_sequence (name, seq) values ('ItemTag_new', max(
+                ifnull((select max(seq) from sqlite_sequence where name = 'ItemTag'), 0), ifnull((select max(Id) from ItemTag_new), 0)));
+            drop table ItemTag;
+            alter table ItemTag_new rename to ItemTag;
+
+            create unique index if not exists i_item_url on Item(Url);
+            create unique index if not exists i_item_combine_guid on Item(Fid, Guid);
+            create index if not exists i_item_combine_fid_read on Item(Fid, Read);
+            create index if not exists i_item_starred on Item(Starred);
+            create unique index if not exists i_tag_combine_name_fid on Tag(Name, Fid);
+            create index if not exists i_tag_fid on Tag(Fid);
+            create unique index if not exists i_itemtag_combine_name_iid on ItemTag(Name, Iid);
+            create index if not exists i_itemtag_iid on ItemTag(Iid);
+        `)
+    }},
+
+    /*
+    The same article could be linked by several feeds, so url of item is unique in a feed instead of globally,
+    i_item_url is kept as a normal index for finding the same article in other feeds. Items without link have an
+    empty url, they are not restricted. Items without guid are given a fallback guid (see fallbackGuid()),
+    the same as new items fetched.
+    */
+    {6, "make url of item unique per feed, and give items without guid a fallback guid", func(session *xorm.Session) error {
+        err := execSql(session, `
+            drop index if exists i_item_url;
+            create index if not exists i_item_url on Item(Url);
+            create unique index if not exists i_item_combine_url on Item(Fid, Url) where Url != '';
+        `)
+        if err != nil {
+            return err
+        }
+
+        var items []*Item
+        err = session.Cols("Id", "Url", "Title", "PubTime").Where("Guid = ''").Find(&items)
+        if err != nil {
+            return err
+        }
+        for _, item := range items {
+            _, err = session.Exec("update Item set Guid = ? where Id = ?", fallbackGuid(item.Url, item.Title, item.PubTime), item.Id)
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    }},
+
+    {7, "create table of item revisions", func(session *xorm.Session) error {
+        err := addColumn(session, "Feed", "MarkUpdatedUnread", "integer not null default 0")   // whether to mark an item unread again when it's changed
+        if err != nil {
+            return err
+        }
+
+        return execSql(session, `
+            create table if not exists 'ItemRevision' (
+                'Id'                integer not null primary key autoincrement,     -- primary key
+                'Iid'               integer not null references Item(Id) on delete cascade, -- Item.id
+                'Title'             text not null,                                  -- title of this version
+                'Content'           text not null,                                  -- content of this version
+                'Hash'              text not null,                                  -- md5sum of content
+                'UpdateTime'        datetime not null                               -- time this version is replaced by the next version
+            );
+
+            create index if not exists i_itemrevision_iid on ItemRevision(Iid);
+        `)
+    }},
+}
+
+
+// Version of database schema this build of QReader requires.
+func TargetSchemaVersion() int {
+    return migrations[len(migrations) - 1].Version
+}
+
+
+/*
+Get current version of database schema, it's the version of the last migration has been run.
+0 means the database is created before migrations were introduced, or it's empty.
+*/
+func CurrentSchemaVersion() (version int, err error) {
+    return schemaVersion(global.Orm.DB().DB)
+}
+
+
+// Get version of database schema of a database.
+func schemaVersion(db *dbsql.DB) (version int, err error) {
+    var count int64
+    err = db.QueryRow("select count(*) from sqlite_master where type = 'table' and name = 'SchemaMigration'").Scan(&count)
+    if err != nil || count == 0 {
+        return
+    }
+
+    err = db.QueryRow("select ifnull(max(Version), 0) from SchemaMigration").Scan(&version)
+    return
+}
+
+
+// Run pending migrations. If backup is true, make a backup copy of the database before migrating.
+func migrate(backup bool) (err error) {
+    current, err := CurrentSchemaVersion()
+    if err != nil {
+        return
+    }
+
+    target := TargetSchemaVersion()
+    if current > target {
+        err = fmt.Errorf("Version of database (%d) is newer than this QReader supports (%d), please upgrade QReader.", current, target)
+        return
+    }
+    if current == target {
+        return
+    }
+
+    if backup {
+        path := fmt.Sprintf("%s.v%d.%s.bak", global.PathDB, current, time.Now().Format(backupTimeFormat))
+        e := BackupDB(path)
+        if e != nil {
+            err = fmt.Errorf("Cannot backup database before migrating: %s", e.Error())
+            return
+        }
+        logInfof("[MODEL] Database is backed up to %s before migrating.", path)
+    }
+
+    _, err = global.Orm.Exec(createSchemaMigrationSql)
+    if err != nil {
+        return
+    }
+
+    for _, m := range migrations {
+        if m.Version <= current {
+            continue
+        }
+
+        err = runMigration(m)
+        if err != nil {
+            err = fmt.Errorf("Migration %d (%s) failed: %s", m.Version, m.Name, err.Error())
+            return
+        }
+        logInfof("[MODEL] Database is migrated to version %d: %s.", m.Version, m.Name)
+    }
+
+    return
+}
+
+
+// Run a migration in a transaction.
+func runMigration(m migration) (err error) {
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+
+    err = m.Up(session)
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    _, err = session.Insert(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedTime: time.Now()})
+    if err != nil {
+        session.Rollback()
+        return
+    }
+
+    return session.Commit()
+}
+
+
+// Write log if the logger is created. It's not created when initializing database before config.ini exists.
+func logInfof(format string, v ...interface{}) {
+    if global.Logger != nil {
+        global.Logger.Infof(format, v...)
+    }
+}
+
+
+func logWarnf(format string, v ...interface{}) {
+    if global.Logger != nil {
+        global.Logger.Warnf(format, v...)
+    }
+}
@@ -0,0 +1,432 @@
+package model
+
+import "encoding/xml"
+import "fmt"
+import "io"
+import "sort"
+import "strings"
+import "sync"
+import "time"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Namespace of QReader's extension attributes in OPML document.
+const OpmlNamespace = "https://github.com/m3ng9i/qreader"
+
+
+// Map to an OPML 1.0/2.0 document.
+type Opml struct {
+    XMLName     xml.Name        `xml:"opml"`
+    Version     string          `xml:"version,attr"`
+    Namespace   string          `xml:"xmlns:qreader,attr,omitempty"`
+    Head        OpmlHead        `xml:"head"`
+    Body        OpmlBody        `xml:"body"`
+}
+
+
+type OpmlHead struct {
+    Title       string          `xml:"title,omitempty"`
+    DateCreated string          `xml:"dateCreated,omitempty"`
+}
+
+
+type OpmlBody struct {
+    Outlines    []*OpmlOutline  `xml:"outline"`
+}
+
+
+// An outline with a xmlUrl attribute is a feed, an outline without xmlUrl is a folder which contains other outlines.
+type OpmlOutline struct {
+    Text        string          `xml:"text,attr"`
+    Title       string          `xml:"title,attr,omitempty"`
+    Type        string          `xml:"type,attr,omitempty"`
+    XmlUrl      string          `xml:"xmlUrl,attr,omitempty"`
+    HtmlUrl     string          `xml:"htmlUrl,attr,omitempty"`
+    OpmlFeedSettings
+    Outlines    []*OpmlOutline  `xml:"outline"`
+}
+
+
+/*
+Settings of a feed in QReader, saved as extension attributes of an outline, e.g.
+<outline text="..." xmlUrl="..." qreader:alias="..." qreader:interval="60"/>
+Zero values mean default settings and will be omitted.
+*/
+type OpmlFeedSettings struct {
+    Alias       string          `xml:"https://github.com/m3ng9i/qreader alias,attr,omitempty"`
+    Interval    int             `xml:"https://github.com/m3ng9i/qreader interval,attr,omitempty"`
+    MaxUnread   uint            `xml:"https://github.com/m3ng9i/qreader maxUnread,attr,omitempty"`
+    MaxKeep     uint            `xml:"https://github.com/m3ng9i/qreader maxKeep,attr,omitempty"`
+    UseProxy    int             `xml:"https://github.com/m3ng9i/qreader useProxy,attr,omitempty"`
+    Note        string          `xml:"https://github.com/m3ng9i/qreader note,attr,omitempty"`
+    Filter      string          `xml:"https://github.com/m3ng9i/qreader filter,attr,omitempty"`
+    MarkUpdatedUnread bool      `xml:"https://github.com/m3ng9i/qreader markUpdatedUnread,attr,omitempty"`
+}
+
+
+// Convert settings to a Feed structure used for updating table Feed. If all the settings are zero values, return nil.
+func (this *OpmlFeedSettings) feed() *Feed {
+    if *this == (OpmlFeedSettings{}) {
+        return nil
+    }
+
+    s := *this
+    feed := new(Feed)
+    if s.Alias != "" {
+        feed.Alias = &s.Alias
+    }
+    if s.Interval != 0 {
+        feed.Interval = &s.Interval
+    }
+    if s.MaxUnread != 0 {
+        feed.MaxUnread = &s.MaxUnread
+    }
+    if s.MaxKeep != 0 {
+        feed.MaxKeep = &s.MaxKeep
+    }
+    if s.Note != "" {
+        feed.Note = &s.Note
+    }
+    if s.Filter != "" {
+        feed.Filter = &s.Filter
+    }
+    if s.MarkUpdatedUnread {
+        feed.MarkUpdatedUnread = &s.MarkUpdatedUnread
+    }
+    feed.UseProxy = s.UseProxy
+    return feed
+}
+
+
+// A feed found in an OPML document.
+type OpmlFeed struct {
+    Url         string          // xmlUrl of the outline
+    Title       string          // text or title of the outline
+    Tags        []string        // names of the folders that contain the outline
+    Settings    OpmlFeedSettings
+}
+
+
+// Parse an OPML document.
+func ParseOpml(r io.Reader) (opml *Opml, err error) {
+    opml = new(Opml)
+    err = xml.NewDecoder(r).Decode(opml)
+    if err != nil {
+        opml = nil
+    }
+    return
+}
+
+
+/*
+Get feeds in the OPML document by walking through all the nested outlines.
+
+Folders that contain a feed become the feed's tags, e.g. a feed in folder "IT" which is in folder "news" will get
+tags "news" and "IT". If a feed appears in several folders, it will be returned only once, with tags of all the folders.
+*/
+func (this *Opml) Feeds() (feeds []*OpmlFeed) {
+
+    index := make(map[string]*OpmlFeed)
+
+    var walk func(outlines []*OpmlOutline, tags []string)
+    walk = func(outlines []*OpmlOutline, tags []string) {
+        for _, outline := range outlines {
+            name := strings.TrimSpace(outline.Text)
+            if name == "" {
+                name = strings.TrimSpace(outline.Title)
+            }
+
+            url := strings.TrimSpace(outline.XmlUrl)
+            if url == "" {
+                // a folder
+                t := tags
+                if name != "" {
+                    t = append(append([]string{}, tags...), name)
+                }
+                walk(outline.Outlines, t)
+                continue
+            }
+
+            feed, ok := index[url]
+            if ok {
+                feed.Tags = trimTags(append(feed.Tags, tags...))
+            } else {
+                feed = &OpmlFeed{Url: url, Title: name, Tags: trimTags(tags), Settings: outline.OpmlFeedSettings}
+                index[url] = feed
+                feeds = append(feeds, feed)
+            }
+
+            // an outline of feed may also contain other outlines
+            walk(outline.Outlines, tags)
+        }
+    }
+
+    walk(this.Body.Outlines, nil)
+    return
+}
+
+
+type OpmlImportStatus string
+const OPML_SUBSCRIBED           OpmlImportStatus = "subscribed"
+const OPML_ALREADY_SUBSCRIBED   OpmlImportStatus = "already subscribed"
+const OPML_FETCH_ERROR          OpmlImportStatus = "fetch error"
+const OPML_PARSE_ERROR          OpmlImportStatus = "parse error"
+const OPML_DB_ERROR             OpmlImportStatus = "database error"
+
+
+// Report of importing one feed in an OPML document.
+type OpmlImportResult struct {
+    Url         string              `json:"url"`        // xmlUrl in the OPML document
+    Name        string              `json:"name"`       // feed name
+    Tags        []string            `json:"tags"`       // tags of the feed
+    Status      OpmlImportStatus    `json:"status"`
+    Id          int64               `json:"id"`         // Feed.Id, 0 if the feed is not subscribed
+    Number      int64               `json:"number"`     // amount of added items
+    Error       string              `json:"error"`      // error message if status is not "subscribed" or "already subscribed"
+}
+
+
+/*
+Import feeds from an OPML document.
+
+Feeds which are already subscribed will be skipped. Other feeds will be fetched (global.FetchConcurrency feeds at one time at most),
+then subscribed in the order of the OPML document, and the folders they belong to will be saved as tags.
+If the document cannot be parsed, err will be returned and results will be nil.
+*/
+func ImportOpml(r io.Reader) (results []*OpmlImportResult, err error) {
+
+    opml, err := ParseOpml(r)
+    if err != nil {
+        return
+    }
+
+    feeds := opml.Feeds()
+    results = make([]*OpmlImportResult, len(feeds))
+    settings := make([]*Feed, len(feeds))
+
+    var wg sync.WaitGroup
+    maxFetch := make(chan bool, global.FetchConcurrency)
+
+    type fetched struct {
+        feed    *Feed
+        items   []*Item
+    }
+    fetchedFeeds := make([]*fetched, len(feeds))
+
+    for i, f := range feeds {
+        results[i] = &OpmlImportResult{Url: f.Url, Name: f.Title, Tags: f.Tags}
+        settings[i] = f.Settings.feed()
+
+        ok, e := IsSubscribed(f.Url)
+        if e != nil {
+            results[i].Status = OPML_DB_ERROR
+            results[i].Error = e.Error()
+            continue
+        }
+        if ok {
+            results[i].Status = OPML_ALREADY_SUBSCRIBED
+            continue
+        }
+
+        wg.Add(1)
+        go func(i int, url string) {
+            maxFetch <- true
+
+            feed, items, e := FetchFeed(url)
+            if e != nil {
+                if IsParseError(e) {
+                    results[i].Status = OPML_PARSE_ERROR
+                } else {
+                    results[i].Status = OPML_FETCH_ERROR
+                }
+                results[i].Error = e.Error()
+            } else {
+                fetchedFeeds[i] = &fetched{feed, items}
+            }
+
+            <- maxFetch
+            wg.Done()
+        }(i, f.Url)
+    }
+    wg.Wait()
+
+    for i, f := range fetchedFeeds {
+        if f == nil {
+            continue
+        }
+        result := results[i]
+
+        // Url of the fetched feed may be different from the url in OPML document.
+        if f.feed.FeedUrl != result.Url {
+            ok, e := IsSubscribed(f.feed.FeedUrl)
+            if e != nil {
+                result.Status = OPML_DB_ERROR
+                result.Error = e.Error()
+                continue
+            }
+            if ok {
+                result.Status = OPML_ALREADY_SUBSCRIBED
+                continue
+            }
+        }
+
+        id, num, name, e := Subscribe(f.feed, f.items, result.Tags...)
+        if e != nil {
+            result.Status = OPML_DB_ERROR
+            result.Error = e.Error()
+            continue
+        }
+        result.Id = id
+        result.Number = num
+        result.Name = name
+        result.Status = OPML_SUBSCRIBED
+
+        if settings[i] != nil && settings[i].Filter != nil {
+            if _, e = ParseFilter(*settings[i].Filter); e != nil {
+                settings[i].Filter = nil
+                result.Error = fmt.Sprintf("Filter of the feed is not saved: %s", e.Error())
+            }
+        }
+
+        if settings[i] != nil {
+            _, e = UpdateFeed(id, settings[i])
+            if e != nil {
+                result.Error = fmt.Sprintf("Feed is subscribed but settings are not saved: %s", e.Error())
+            }
+        }
+    }
+
+    return
+}
+
+
+// Create an outline of a feed.
+func feedOutline(feed *Feed) *OpmlOutline {
+    outline := new(OpmlOutline)
+    outline.Text    = feed.Name
+    outline.Title   = feed.Name
+    outline.Type    = "rss"
+    outline.XmlUrl  = feed.FeedUrl
+    outline.HtmlUrl = feed.Url
+
+    if feed.Alias != nil {
+        outline.Alias = *feed.Alias
+        if outline.Alias != "" {
+            outline.Text = outline.Alias
+        }
+    }
+    if feed.Interval != nil {
+        outline.Interval = *feed.Interval
+    }
+    if feed.MaxUnread != nil {
+        outline.MaxUnread = *feed.MaxUnread
+    }
+    if feed.MaxKeep != nil {
+        outline.MaxKeep = *feed.MaxKeep
+    }
+    if feed.Note != nil {
+        outline.Note = *feed.Note
+    }
+    if feed.Filter != nil {
+        outline.Filter = *feed.Filter
+    }
+    if feed.MarkUpdatedUnread != nil {
+        outline.MarkUpdatedUnread = *feed.MarkUpdatedUnread
+    }
+    outline.UseProxy = feed.UseProxy
+
+    return outline
+}
+
+
+/*
+Export subscriptions as an OPML 2.0 document.
+
+Feeds are grouped into folders by tag, a feed with several tags will appear in each folder, feeds without tag are
+placed at the top level. Settings of feeds are saved as extension attributes in namespace OpmlNamespace.
+*/
+func ExportOpml() (opml *Opml, err error) {
+
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+
+    rows, err := getTagAndFeedIds(session)
+    if err != nil {
+        session.Commit()
+        return
+    }
+    session.Commit()
+
+    // tags of each feed are exported as they are, tags differ only in case are not combined like getTagWithFeedIds()
+    tags := make(TagWithFeedIds)
+    for _, row := range rows {
+        tags[row.Tag] = append(tags[row.Tag], row.FeedId)
+    }
+
+    feeds, err := GetFeedList()
+    if err != nil {
+        return
+    }
+
+    outlines := make(map[int64]*Feed)
+    for _, feed := range feeds {
+        outlines[feed.Id] = feed
+    }
+
+    var names []string
+    for name, _ := range tags {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    o := new(Opml)
+    o.Version = "2.0"
+    o.Namespace = OpmlNamespace
+    o.Head.Title = "QReader subscriptions"
+    o.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+
+    var folders []*OpmlOutline
+    for _, name := range names {
+        var children []*OpmlOutline
+        for _, fid := range tags[name] {
+            feed, ok := outlines[fid]
+            if !ok {
+                continue
+            }
+            children = append(children, feedOutline(feed))
+        }
+
+        if name == "" {
+            // feeds without tag
+            o.Body.Outlines = append(o.Body.Outlines, children...)
+        } else if len(children) > 0 {
+            folders = append(folders, &OpmlOutline{Text: name, Title: name, Outlines: children})
+        }
+    }
+    o.Body.Outlines = append(o.Body.Outlines, folders...)
+
+    opml = o
+    return
+}
+
+
+// Write OPML document to w.
+func (this *Opml) Write(w io.Writer) (err error) {
+    b, err := xml.MarshalIndent(this, "", "    ")
+    if err != nil {
+        return
+    }
+
+    _, err = io.WriteString(w, xml.Header)
+    if err != nil {
+        return
+    }
+
+    _, err = w.Write(b)
+    return
+}
@@ -0,0 +1,37 @@
+package model
+
+import "testing"
+
+
+// Tags of different feeds which differ only in case are exported as they are, not combined.
+func TestExportOpmlTagCase(t *testing.T) {
+    defer openTestDB(t)()
+
+    for i, tag := range []string{"News", "news", ""} {
+        feed, _ := testFeedWithoutGuid(nil, nil)
+        feed.FeedUrl = feed.FeedUrl + string(rune('a' + i))
+        _, _, _, err := Subscribe(feed, nil, tag)
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    opml, err := ExportOpml()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    folders := make(map[string]int)
+    top := 0
+    for _, outline := range opml.Body.Outlines {
+        if outline.XmlUrl != "" {
+            top++
+            continue
+        }
+        folders[outline.Text] = len(outline.Outlines)
+    }
+
+    if top != 1 || len(folders) != 2 || folders["News"] != 1 || folders["news"] != 1 {
+        t.Errorf("got %d feeds at top level and folders %v, want 1 feed and folders News and news with 1 feed each", top, folders)
+    }
+}
@@ -0,0 +1,96 @@
+package model
+
+import "time"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Max number of revisions kept for an item, older revisions are deleted.
+const maxItemRevisions = 20
+
+
+/*
+Update an item which already exists in the feed if its title or content has been changed by the publisher,
+the content is compared by Item.Hash. The previous version is saved to table ItemRevision.
+If markUnread is true, the item is marked unread again.
+
+The item is found by Fid and Guid. If it's not found and the item has a guid made by fallbackGuid(), which changes
+with the title, it's found by Fid and Url, and its guid is updated too. Items of a feed may share a url (e.g. the
+home page) or have no url, so an item found by url is not used if its guid is in fetched, the guids of items fetched
+with this item: it's another item still in the feed.
+
+An item whose content becomes empty is not updated, some feeds leave out content of old items.
+If the item does not exist or is not changed, updated is false.
+*/
+func updateChangedItem(session *xorm.Session, item *Item, markUnread bool, fetched map[string]bool) (updated bool, err error) {
+    existing := new(Item)
+    ok, err := session.Cols("Id", "Guid", "Title", "Content", "Hash").Where("Fid = ? and Guid = ?", item.Fid, item.Guid).Get(existing)
+    if err != nil {
+        return
+    }
+    if !ok {
+        if !isFallbackGuid(item.Guid) || item.Url == "" {
+            return
+        }
+        ok, err = session.Cols("Id", "Guid", "Title", "Content", "Hash").Where("Fid = ? and Url = ?", item.Fid, item.Url).Get(existing)
+        if err != nil || !ok || fetched[existing.Guid] {
+            return
+        }
+    }
+
+    if existing.Hash == item.Hash && existing.Title == item.Title {
+        if existing.Guid != item.Guid {
+            _, err = session.Exec("update Item set Guid = ? where Id = ?", item.Guid, existing.Id)
+        }
+        return
+    }
+    if item.Content == "" && existing.Content != "" {
+        return
+    }
+
+    revision := &ItemRevision{
+        Iid:        existing.Id,
+        Title:      existing.Title,
+        Content:    existing.Content,
+        Hash:       existing.Hash,
+        UpdateTime: time.Now(),
+    }
+    _, err = session.Insert(revision)
+    if err != nil {
+        return
+    }
+
+    sql := "update Item set Guid = ?, Title = ?, Content = ?, Hash = ? where Id = ?"
+    if markUnread {
+        sql = "update Item set Guid = ?, Title = ?, Content = ?, Hash = ?, Read = 0 where Id = ?"
+    }
+    _, err = session.Exec(sql, item.Guid, item.Title, item.Content, item.Hash, existing.Id)
+    if err != nil {
+        return
+    }
+
+    // keep the latest revisions only
+    _, err = session.Exec(`delete from ItemRevision where Iid = ? and Id not in
+        (select Id from ItemRevision where Iid = ? order by Id desc limit ?)`, existing.Id, existing.Id, maxItemRevisions)
+    if err != nil {
+        return
+    }
+
+    item.Id = existing.Id
+    updated = true
+    return
+}
+
+
+// Get number of revisions of an item.
+func CountItemRevisions(iid int64) (n int64, err error) {
+    n, err = global.Orm.Where("Iid = ?", iid).Count(&ItemRevision{})
+    return
+}
+
+
+// Get revisions of an item, the oldest is the first. list is empty if the item has never been changed.
+func GetItemRevisions(iid int64) (list []*ItemRevision, err error) {
+    err = global.Orm.Where("Iid = ?", iid).Asc("Id").Find(&list)
+    return
+}
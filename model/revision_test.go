@@ -0,0 +1,138 @@
+package model
+
+import "testing"
+import "time"
+import "github.com/m3ng9i/feedreader"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Assemble a feed of items without guid, the same as a fetched feed.
+func testFeedWithoutGuid(titles, contents []string) (*Feed, []*Item) {
+    fd := &feedreader.Feed{Title: "Example", Link: "http://example.com/", FeedLink: "http://example.com/feed", Type: "rss"}
+    for i := range titles {
+        fd.Items = append(fd.Items, &feedreader.FeedItem{
+            Link:       "http://example.com/post/1",
+            Title:      titles[i],
+            Content:    contents[i],
+            PubDate:    time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+        })
+    }
+    return assembleFeed(fd)
+}
+
+
+// The title of an item without guid is changed, so is its fallback guid, the item should be found by url and updated.
+func TestRenewFeedUpdatesItemWithoutGuid(t *testing.T) {
+    defer openTestDB(t)()
+
+    feed, items := testFeedWithoutGuid([]string{"Old title"}, []string{"Old content"})
+    fid, num, _, err := Subscribe(feed, items)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if num != 1 {
+        t.Fatalf("subscribe: got %d items, want 1", num)
+    }
+    _, err = global.Orm.Exec("update Item set Read = 1 where Fid = ?", fid)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    feed, items = testFeedWithoutGuid([]string{"New title"}, []string{"New content"})
+    if items[0].Guid == fallbackGuid("http://example.com/post/1", "Old title", items[0].PubTime) {
+        t.Fatal("fallback guid should change with the title")
+    }
+
+    affected, err := renewFeed(FeedRenewInfo{Id: fid, Feed: feed, Items: items, FetchTime: time.Now(), MarkUpdatedUnread: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if affected != 0 {
+        t.Errorf("renew: got %d new items, want 0", affected)
+    }
+
+    var saved []*Item
+    err = global.Orm.Where("Fid = ?", fid).Find(&saved)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(saved) != 1 {
+        t.Fatalf("items: got %d, want 1", len(saved))
+    }
+    item := saved[0]
+    if item.Title != "New title" || item.Content != "New content" || item.Guid != items[0].Guid {
+        t.Errorf("item: got title '%s', content '%s', guid '%s', want the new version", item.Title, item.Content, item.Guid)
+    }
+    if item.Read {
+        t.Error("item should be marked unread again")
+    }
+
+    revisions, err := GetItemRevisions(item.Id)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(revisions) != 1 || revisions[0].Title != "Old title" || revisions[0].Content != "Old content" {
+        t.Fatalf("revisions: got %d, want the old version", len(revisions))
+    }
+
+    // fetching the same version again changes nothing
+    feed, items = testFeedWithoutGuid([]string{"New title"}, []string{"New content"})
+    _, err = renewFeed(FeedRenewInfo{Id: fid, Feed: feed, Items: items, FetchTime: time.Now()})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n, err := CountItemRevisions(item.Id); err != nil || n != 1 {
+        t.Errorf("revisions after fetching the same version: got %d, want 1", n)
+    }
+}
+
+
+// Different items sharing one link, or having no link, should not overwrite each other when the feed is fetched.
+func TestRenewFeedItemsSharingUrl(t *testing.T) {
+    defer openTestDB(t)()
+
+    titles := []string{"First", "Second"}
+    contents := []string{"First content", "Second content"}
+
+    feed, items := testFeedWithoutGuid(titles, contents)
+    fid, _, _, err := Subscribe(feed, items)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // items without link have an empty url
+    linkless := []string{"Third", "Fourth"}
+    feed, items = testFeedWithoutGuid(append(titles, linkless...), append(contents, "Third content", "Fourth content"))
+    items[2].Url = ""
+    items[3].Url = ""
+
+    for i := 0; i < 2; i++ {
+        _, err = renewFeed(FeedRenewInfo{Id: fid, Feed: feed, Items: items, FetchTime: time.Now(), MarkUpdatedUnread: true})
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    var saved []*Item
+    err = global.Orm.Where("Fid = ?", fid).Asc("Id").Find(&saved)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // the second item is dropped for its url is the same as the first one, and the first one is kept as it is
+    want := []string{"First", "Third", "Fourth"}
+    if len(saved) != len(want) {
+        t.Fatalf("items: got %d, want %d", len(saved), len(want))
+    }
+    for i, item := range saved {
+        if item.Title != want[i] {
+            t.Errorf("item %d: got title '%s', want '%s'", i, item.Title, want[i])
+        }
+        if n, err := CountItemRevisions(item.Id); err != nil || n != 0 {
+            t.Errorf("revisions of item %d: got %d, want 0", i, n)
+        }
+    }
+    if saved[0].Content != "First content" || saved[0].Guid != items[0].Guid {
+        t.Errorf("the first item is overwritten: got content '%s', guid '%s'", saved[0].Content, saved[0].Guid)
+    }
+}
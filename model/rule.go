@@ -0,0 +1,306 @@
+package model
+
+import "fmt"
+import "strings"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Max number of items returned by DryRunRule().
+const dryRunMaxItems = 500
+
+
+// Actions of a rule.
+type RuleAction struct {
+    Read    bool        // mark item read
+    Star    bool        // mark item starred
+    Tags    []string    // add tags to item
+}
+
+
+type RuleSyntaxError struct {
+    Field   string      // "condition" or "action"
+    Msg     string
+}
+
+
+func (e *RuleSyntaxError) Error() string {
+    return fmt.Sprintf("%s of rule is not correct: %s", e.Field, e.Msg)
+}
+
+
+/*
+Parse actions of a rule. Actions are separated by comma:
+
+    read        mark item read
+    star        mark item starred
+    tag:<name>  add a tag to item
+
+e.g. "star, tag:product"
+*/
+func ParseRuleAction(s string) (action RuleAction, err error) {
+
+    for _, a := range strings.Split(s, ",") {
+        a = strings.TrimSpace(a)
+        if a == "" {
+            continue
+        }
+
+        switch strings.ToLower(a) {
+            case "read":
+                action.Read = true
+            case "star":
+                action.Star = true
+            default:
+                if len(a) > 4 && strings.EqualFold(a[:4], "tag:") && strings.TrimSpace(a[4:]) != "" {
+                    action.Tags = append(action.Tags, a[4:])
+                } else {
+                    err = &RuleSyntaxError{"action", fmt.Sprintf("unknown action: %s", a)}
+                    return
+                }
+        }
+    }
+
+    action.Tags = trimTags(action.Tags)
+
+    if !action.Read && !action.Star && len(action.Tags) == 0 {
+        err = &RuleSyntaxError{"action", "action is empty"}
+    }
+    return
+}
+
+
+// A rule which condition and action have been parsed.
+type parsedRule struct {
+    *Rule
+    condition   Condition
+    action      RuleAction
+}
+
+
+func parseRule(rule *Rule) (r *parsedRule, err error) {
+    c, err := ParseCondition(rule.Condition, allConditionKeys)
+    if err != nil {
+        err = &RuleSyntaxError{"condition", err.Error()}
+        return
+    }
+
+    a, err := ParseRuleAction(rule.Action)
+    if err != nil {
+        return
+    }
+
+    r = &parsedRule{rule, c, a}
+    return
+}
+
+
+// Check if condition and action of a rule are correct, if not, a RuleSyntaxError will be returned.
+func CheckRule(rule *Rule) (err error) {
+    _, err = parseRule(rule)
+    return
+}
+
+
+type ruleSet []*parsedRule
+
+
+// Load enabled rules. Rules cannot be parsed are skipped.
+func loadRules(session *xorm.Session) (rules ruleSet, err error) {
+    var list []*Rule
+    err = session.Where("Enabled = 1").Asc("Id").Find(&list)
+    if err != nil {
+        return
+    }
+
+    for _, rule := range list {
+        r, e := parseRule(rule)
+        if e != nil {
+            global.Logger.Errorf("[RULE] rule is skipped: %s, rule id: %d", e.Error(), rule.Id)
+            continue
+        }
+        rules = append(rules, r)
+    }
+    return
+}
+
+
+/*
+Apply rules on an item before it's saved. tags are tags of the item's feed.
+
+Actions of all the matched rules are applied: item.Read and item.Starred are set, and tags the item should be
+added are returned. Tags should be saved by saveItemTags() after the item is inserted.
+*/
+func (this ruleSet) apply(item *Item, tags []string) (itemTags []string) {
+    for _, rule := range this {
+        if !rule.condition.Match(item, tags) {
+            continue
+        }
+
+        if rule.action.Read {
+            item.Read = true
+        }
+        if rule.action.Star {
+            item.Starred = true
+        }
+        itemTags = append(itemTags, rule.action.Tags...)
+    }
+    return trimTags(itemTags)
+}
+
+
+// Add tags to an item, existing tags are ignored.
+func saveItemTags(session *xorm.Session, iid int64, tags []string) (err error) {
+    for _, tag := range tags {
+        _, err = session.Exec("insert or ignore into ItemTag (Iid, Name) values (?, ?)", iid, tag)
+        if err != nil {
+            return
+        }
+    }
+    return
+}
+
+
+// Get tags of a feed.
+func getTagsByFid(session *xorm.Session, fid int64) (tags []string, err error) {
+    var t []*Tag
+    err = session.Cols("Name").Where("Fid = ?", fid).Find(&t)
+    if err != nil {
+        return
+    }
+    for _, i := range t {
+        tags = append(tags, i.Name)
+    }
+    return
+}
+
+
+// Get all the rules.
+func GetRuleList() (rules []*Rule, err error) {
+    err = global.Orm.Asc("Id").Find(&rules)
+    return
+}
+
+
+// Get a rule by Rule.Id. If the rule is not found, ok is false.
+func GetRule(id int64) (rule *Rule, ok bool, err error) {
+    var r Rule
+    ok, err = global.Orm.Id(id).Get(&r)
+    rule = &r
+    return
+}
+
+
+// Add a rule. If condition or action of the rule is not correct, a RuleSyntaxError will be returned.
+func AddRule(rule *Rule) (id int64, err error) {
+    err = CheckRule(rule)
+    if err != nil {
+        return
+    }
+
+    _, err = global.Orm.Insert(rule)
+    if err != nil {
+        return
+    }
+    id = rule.Id
+    return
+}
+
+
+// Update all the fields of a rule. If condition or action of the rule is not correct, a RuleSyntaxError will be returned.
+func UpdateRule(id int64, rule *Rule) (ok bool, err error) {
+    err = CheckRule(rule)
+    if err != nil {
+        return
+    }
+
+    affected, err := global.Orm.Id(id).Cols("Name", "Condition", "Action", "Enabled").Update(rule)
+    if affected > 0 {
+        ok = true
+    }
+    return
+}
+
+
+// Delete a rule. Actions have been applied by the rule will not be reverted.
+func DeleteRule(id int64) (ok bool, err error) {
+    affected, err := global.Orm.Id(id).Delete(&Rule{})
+    if affected > 0 {
+        ok = true
+    }
+    return
+}
+
+
+// An item matched by a rule in dry run.
+type RuleMatch struct {
+    Id          int64       `json:"item_id"`
+    Fid         int64       `json:"item_fid"`
+    Title       string      `json:"item_title"`
+    Url         string      `json:"item_url"`
+    Read        bool        `json:"item_read"`
+    Starred     bool        `json:"item_starred"`
+}
+
+
+type RuleDryRunResult struct {
+    Number      int64           `json:"number"`     // amount of matched items
+    Items       []*RuleMatch    `json:"items"`      // matched items, dryRunMaxItems items at most
+}
+
+
+/*
+Report which existing items a rule would match, nothing will be changed.
+The rule does not need to be saved, and Rule.Enabled is ignored.
+*/
+func DryRunRule(rule *Rule) (result RuleDryRunResult, err error) {
+
+    r, err := parseRule(rule)
+    if err != nil {
+        return
+    }
+
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+    defer session.Commit()
+
+    t, err := getTagAndFeedIds(session)
+    if err != nil {
+        return
+    }
+    tags := make(map[int64][]string)
+    for _, i := range t {
+        if i.Tag != "" {
+            tags[i.FeedId] = append(tags[i.FeedId], i.Tag)
+        }
+    }
+
+    result.Items = []*RuleMatch{}
+
+    err = session.Asc("Id").Iterate(new(Item), func(i int, bean interface{}) error {
+        item := bean.(*Item)
+        if !r.condition.Match(item, tags[item.Fid]) {
+            return nil
+        }
+
+        result.Number++
+        if len(result.Items) < dryRunMaxItems {
+            result.Items = append(result.Items, &RuleMatch{
+                Id:         item.Id,
+                Fid:        item.Fid,
+                Title:      item.Title,
+                Url:        item.Url,
+                Read:       item.Read,
+                Starred:    item.Starred,
+            })
+        }
+        return nil
+    })
+
+    return
+}
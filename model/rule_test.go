@@ -0,0 +1,50 @@
+package model
+
+import "testing"
+import "github.com/m3ng9i/qreader/global"
+
+
+// Tag conditions of global rules should match items of a new feed, tags of the feed are saved before the items.
+func TestSubscribeAppliesRulesWithTags(t *testing.T) {
+    defer openTestDB(t)()
+
+    _, err := AddRule(&Rule{Name: "news", Condition: "tag:news", Action: "star,tag:from-news", Enabled: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    feed, items := testFeedWithoutGuid([]string{"First"}, []string{"First content"})
+    fid, num, _, err := Subscribe(feed, items, "News", " news ", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if num != 1 {
+        t.Fatalf("subscribe: got %d items, want 1", num)
+    }
+
+    var tags []*Tag
+    err = global.Orm.Where("Fid = ?", fid).Find(&tags)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(tags) != 1 || tags[0].Name != "News" {
+        t.Errorf("tags of feed: got %d, want 'News' only", len(tags))
+    }
+
+    item := new(Item)
+    _, err = global.Orm.Where("Fid = ?", fid).Get(item)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !item.Starred {
+        t.Error("item should be starred by the rule")
+    }
+
+    n, err := global.Orm.Where("Iid = ? and Name = ?", item.Id, "from-news").Count(&ItemTag{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n != 1 {
+        t.Errorf("item tag: got %d, want 1", n)
+    }
+}
@@ -0,0 +1,180 @@
+package model
+
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/qreader/global"
+
+
+/*
+Check query of a saved search by Search(), err is SearchQueryError if the query is not correct.
+If PageSize is not set and the query contains "num", PageSize is set to the value of num.
+*/
+func checkSavedSearch(ss *SavedSearch) (err error) {
+    sq, err := Search(ss.Query)
+    if err != nil {
+        return
+    }
+
+    if ss.PageSize <= 0 && sq.Num != nil {
+        ss.PageSize = *sq.Num
+    }
+    return
+}
+
+
+// Get all the saved searches.
+func GetSavedSearchList() (list []*SavedSearch, err error) {
+    err = global.Orm.Asc("Id").Find(&list)
+    return
+}
+
+
+// Get a saved search by SavedSearch.Id. If the saved search is not found, ok is false.
+func GetSavedSearch(id int64) (ss *SavedSearch, ok bool, err error) {
+    var s SavedSearch
+    ok, err = global.Orm.Id(id).Get(&s)
+    ss = &s
+    return
+}
+
+
+// Add a saved search. If the query is not correct, a SearchQueryError will be returned.
+func AddSavedSearch(ss *SavedSearch) (id int64, err error) {
+    err = checkSavedSearch(ss)
+    if err != nil {
+        return
+    }
+
+    _, err = global.Orm.Insert(ss)
+    if err != nil {
+        return
+    }
+    id = ss.Id
+    return
+}
+
+
+// Update all the fields of a saved search. If the query is not correct, a SearchQueryError will be returned.
+func UpdateSavedSearch(id int64, ss *SavedSearch) (ok bool, err error) {
+    err = checkSavedSearch(ss)
+    if err != nil {
+        return
+    }
+
+    affected, err := global.Orm.Id(id).Cols("Name", "Query", "PageSize").Update(ss)
+    if affected > 0 {
+        ok = true
+    }
+    return
+}
+
+
+// Delete a saved search.
+func DeleteSavedSearch(id int64) (ok bool, err error) {
+    affected, err := global.Orm.Id(id).Delete(&SavedSearch{})
+    if affected > 0 {
+        ok = true
+    }
+    return
+}
+
+
+type SavedSearchWithAmount struct {
+    SavedSearch
+    Unread uint64 `json:"unread"`
+}
+
+
+/*
+Get saved search list with unread number. Unread number is the number of unread articles matched by the query,
+option "read" of the query is ignored. If the query of a saved search cannot be parsed, its unread number is 0.
+
+Like GetFeedListWithAmount(), session could be nil.
+*/
+func GetSavedSearchListWithAmount(session *xorm.Session) (list []*SavedSearchWithAmount, err error) {
+
+    if session == nil {
+        session = global.Orm.NewSession()
+        defer session.Close()
+    }
+
+    var searches []*SavedSearch
+    err = session.Asc("Id").Find(&searches)
+    if err != nil {
+        return
+    }
+
+    for _, ss := range searches {
+        item := &SavedSearchWithAmount{SavedSearch: *ss}
+        list = append(list, item)
+
+        sq, e := Search(ss.Query)
+        if e != nil {
+            global.Logger.Errorf("[MODEL] query of saved search is not correct: %s, saved search id: %d", e.Error(), ss.Id)
+            continue
+        }
+
+        n, e := sq.countUnread(session)
+        if e != nil {
+            err = e
+            return
+        }
+        item.Unread = uint64(n)
+    }
+
+    return
+}
+
+
+// Get feed list and saved search list with unread numbers in one transaction, so the numbers are consistent.
+func GetFeedAndSavedSearchList() (feeds []*FeedWithAmount, searches []*SavedSearchWithAmount, err error) {
+
+    session := global.Orm.NewSession()
+    defer session.Close()
+
+    err = session.Begin()
+    if err != nil {
+        return
+    }
+    // only read in the transaction
+    defer session.Commit()
+
+    feeds, err = GetFeedListWithAmount(session)
+    if err != nil {
+        return
+    }
+
+    searches, err = GetSavedSearchListWithAmount(session)
+    return
+}
+
+
+// Get a saved search and its SearchQuery. If the saved search is not found, ok is false.
+func getSavedSearchQuery(id int64) (sq SearchQuery, ok bool, err error) {
+    ss, ok, err := GetSavedSearch(id)
+    if err != nil || !ok {
+        return
+    }
+    sq, err = Search(ss.Query)
+    return
+}
+
+
+// Get article list of a saved search. If the saved search is not found, ok is false. cursor is optional, see SearchQuery.ListByOffset().
+func GetArticleListBySavedSearch(id int64, limit, offset int, cursor ...string) (list ArticleList, ok bool, err error) {
+    sq, ok, err := getSavedSearchQuery(id)
+    if err != nil || !ok {
+        return
+    }
+    list, err = sq.ListByOffset(limit, offset, cursor...)
+    return
+}
+
+
+// Mark all the articles matched by a saved search read. If the saved search is not found, affected is 0.
+func MarkArticlesReadBySavedSearch(id int64) (affected int64, err error) {
+    sq, ok, err := getSavedSearchQuery(id)
+    if err != nil || !ok {
+        return
+    }
+    return sq.MarkRead()
+}
@@ -1,20 +1,20 @@
 package model
 
 import "fmt"
+import "regexp"
 import "strings"
 import "strconv"
+import "time"
+import "github.com/go-xorm/xorm"
 import qp "github.com/m3ng9i/go-utils/query-parser"
 import "github.com/m3ng9i/go-utils/slice"
 import "github.com/m3ng9i/qreader/global"
 
 type SearchQuery struct {
-    Fid     *[]int64
-    Title   *[]string
-    Content *[]string
+    Expr    *SearchExpr // conditions of articles, nil: all articles
     Read    *bool // nil: unread
     Orderby *[]string
     Asc     *bool
-    Tag     *[]string
     Starred *bool // nil: any
     Num     *int // nil: default value
 }
@@ -47,6 +47,7 @@ func legalOrderbyColumn(c string) bool {
         "fetchtime",
         "starred",
         "read",
+        "rank", // relevance of keywords, only meaningful when keyword, title or content is provided
     }
 
     for _, col := range columns {
@@ -58,12 +59,37 @@ func legalOrderbyColumn(c string) bool {
     return false
 }
 
-// Get SearchQuery structure base on a search query.
-// err may be qp.InvalidCharError or SearchQueryError.
-// E.g. sq, err := Search("fid:22 title:'article title' orderby:title order:asc")
+
+// Keys of search query which are options of the result, they could only be used at top level, and could not be negative.
+func isSearchOption(key string) bool {
+    switch key {
+        case "read", "starred", "orderby", "order", "num":
+            return true
+    }
+    return false
+}
+
+
+// Keys of search query which are conditions of articles.
+func isSearchCondition(key string) bool {
+    switch key {
+        case "", "keyword", "title", "content", "author", "url", "feed", "fid", "tag", "pubtime", "fetchtime":
+            return true
+    }
+    return false
+}
+
+
+/*
+Get SearchQuery structure base on a search query.
+err is SearchQueryError if the query is not correct.
+E.g. sq, err := Search("fid:22 title:'article title' -tag:news pubtime:>2026-01-01 orderby:title order:asc")
+
+See SearchExpr for the syntax of conditions.
+*/
 func Search(q string) (sq SearchQuery, err error) {
 
-    nodes, err := qp.Parse(q)
+    expr, err := parseSearchExpr(q)
     if err != nil {
         return
     }
@@ -73,72 +99,33 @@ func Search(q string) (sq SearchQuery, err error) {
 
     readAny := false
 
-    for _, node := range *nodes {
-
-        if node.Negative {
-            err = &SearchQueryError {
-                Node: node,
-                Msg: fmt.Sprintf("Incorrect use of '-' in key: %s", node.Key),
-            }
-            return
+    var top []*SearchExpr
+    if expr != nil {
+        if expr.Op == SEARCH_AND {
+            top = expr.Exprs
+        } else {
+            top = []*SearchExpr{expr}
         }
+    }
 
-        switch strings.ToLower(node.Key) {
-            case "fid":
-                var fids []int64
-                for _, value := range node.Values {
-                    fid, e := strconv.ParseInt(value, 10, 64)
-                    if e != nil || fid <= 0 {
-                        err = &SearchQueryError {
-                            Node: node,
-                            Msg: fmt.Sprintf("Incorrect fid value: %s", value),
-                        }
-                        return
-                    }
-                    fids = append(fids, fid)
-                }
-                if len(fids) > 0 {
-                    if sq.Fid != nil {
-                        *sq.Fid = append(*sq.Fid, fids...)
-                    } else {
-                        sq.Fid = &fids
-                    }
-                }
-
-            case "": fallthrough
-            case "keyword":
-                v := node.Values
-
-                if sq.Title != nil {
-                    *sq.Title = append(*sq.Title, node.Values...)
-                } else {
-                    sq.Title = &v
-                }
+    var conditions []*SearchExpr
 
-                if sq.Content != nil {
-                    *sq.Content = append(*sq.Content, node.Values...)
-                } else {
-                    sq.Content = &v
-                }
+    for _, e := range top {
 
-            case "title":
-                if sq.Title != nil {
-                    *sq.Title = append(*sq.Title, node.Values...)
-                } else {
-                    v := node.Values
-                    sq.Title = &v
-                }
+        if e.Op != SEARCH_TERM || !isSearchOption(e.Key) {
+            err = checkSearchExpr(e)
+            if err != nil {
+                return
+            }
+            conditions = append(conditions, e)
+            continue
+        }
 
-            case "content":
-                if sq.Content != nil {
-                    *sq.Content = append(*sq.Content, node.Values...)
-                } else {
-                    v := node.Values
-                    sq.Content = &v
-                }
+        node := qp.Node{Key: e.Key, Values: e.Values}
 
+        switch e.Key {
             case "read":
-                if sq.Read != nil {
+                if sq.Read != nil || readAny {
                     err = &SearchQueryError {
                         Node: node,
                         Msg: "'read' has already been set.",
@@ -176,6 +163,16 @@ func Search(q string) (sq SearchQuery, err error) {
                 }
 
             case "orderby":
+                for _, value := range node.Values {
+                    if !legalOrderbyColumn(value) {
+                        err = &SearchQueryError {
+                            Node: node,
+                            Msg: fmt.Sprintf("Value of 'orderby' is not correct: %s", value),
+                        }
+                        return
+                    }
+                }
+
                 if sq.Orderby != nil {
                     *sq.Orderby = append(*sq.Orderby, node.Values...)
                 } else {
@@ -214,14 +211,6 @@ func Search(q string) (sq SearchQuery, err error) {
                         return
                 }
 
-            case "tag":
-                if sq.Tag != nil {
-                    *sq.Tag = append(*sq.Tag, node.Values...)
-                } else {
-                    v := node.Values
-                    sq.Tag = &v
-                }
-
             case "starred":
                 if sq.Starred != nil {
                     err = &SearchQueryError {
@@ -284,17 +273,17 @@ func Search(q string) (sq SearchQuery, err error) {
                     return
                 }
                 sq.Num = &num
-
-
-            default:
-                err = &SearchQueryError {
-                    Node: node,
-                    Msg: fmt.Sprintf("Do not support key: %s", node.Key),
-                }
-                return
         }
     }
 
+    switch len(conditions) {
+        case 0:
+        case 1:
+            sq.Expr = conditions[0]
+        default:
+            sq.Expr = &SearchExpr{Op: SEARCH_AND, Exprs: conditions}
+    }
+
     // set default values
     if sq.Orderby == nil || len(*sq.Orderby) == 0 {
         sq.Orderby = &[]string{"Id"}
@@ -308,153 +297,579 @@ func Search(q string) (sq SearchQuery, err error) {
 
     // remove duplicate values
 
-    if sq.Fid != nil {
-        *sq.Fid = slice.Unique(*sq.Fid).([]int64)
+    if sq.Orderby != nil {
+        *sq.Orderby = slice.Unique(*sq.Orderby).([]string)
     }
 
-    if sq.Title != nil {
-        *sq.Title = slice.Unique(*sq.Title).([]string)
+    return
+}
+
+
+// Check keys and values of terms in an expression, options (e.g. read, orderby) are not allowed.
+func checkSearchExpr(expr *SearchExpr) (err error) {
+
+    if expr.Op != SEARCH_TERM {
+        for _, e := range expr.Exprs {
+            err = checkSearchExpr(e)
+            if err != nil {
+                return
+            }
+        }
+        return
     }
 
-    if sq.Content != nil {
-        *sq.Content = slice.Unique(*sq.Content).([]string)
+    node := qp.Node{Key: expr.Key, Values: expr.Values}
+
+    if isSearchOption(expr.Key) {
+        err = &SearchQueryError {
+            Node: node,
+            Msg: fmt.Sprintf("'%s' could not be used with '-', 'OR' or in parentheses.", expr.Key),
+        }
+        return
     }
 
-    if sq.Orderby != nil {
-        *sq.Orderby = slice.Unique(*sq.Orderby).([]string)
+    if !isSearchCondition(expr.Key) {
+        err = &SearchQueryError {
+            Node: node,
+            Msg: fmt.Sprintf("Do not support key: %s", expr.Key),
+        }
+        return
     }
 
-    if sq.Tag != nil {
-        *sq.Tag = slice.Unique(*sq.Tag).([]string)
+    for _, value := range expr.Values {
+        switch expr.Key {
+            case "fid":
+                fid, e := strconv.ParseInt(value, 10, 64)
+                if e != nil || fid <= 0 {
+                    err = &SearchQueryError {
+                        Node: node,
+                        Msg: fmt.Sprintf("Incorrect fid value: %s", value),
+                    }
+                    return
+                }
+
+            case "pubtime", "fetchtime":
+                _, _, e := timeCondition("", value, time.Now())
+                if e != nil {
+                    err = &SearchQueryError {
+                        Node: node,
+                        Msg: fmt.Sprintf("Incorrect %s value: %s, %s", expr.Key, value, e.Error()),
+                    }
+                    return
+                }
+        }
     }
 
     return
 }
 
 
-// Get article list of search query.
-func (this *SearchQuery) List(page int) (list ArticleList, err error) {
+// Format time as the format saved in database by xorm.
+func dbTime(t time.Time) string {
+    return t.In(time.Local).Format("2006-01-02 15:04:05")
+}
 
-    session := global.Orm.NewSession()
-    defer session.Close()
 
-    err = session.Begin()
-    if err != nil {
-        return
+var relativeTimeRe = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+var timeLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"}
+
+
+/*
+Create sql of a time condition, column is a column of time, e.g. Item.PubTime.
+
+value is: [<op>]<time>, op is one of: >, >=, <, <=, =. time is:
+
+    absolute time:  2006-01-02, 2006-01-02T15:04, 2006-01-02T15:04:05, in local time zone.
+                    "=2006-01-02" or "2006-01-02" means the whole day.
+    relative time:  age of article, number of minutes (m), hours (h), days (d) or weeks (w), e.g. "<7d" means
+                    newer than 7 days, ">12h" means older than 12 hours. op could not be omitted.
+*/
+func timeCondition(column, value string, now time.Time) (sql string, args []interface{}, err error) {
+
+    op := ""
+    for _, o := range []string{">=", "<=", ">", "<", "="} {
+        if strings.HasPrefix(value, o) {
+            op = o
+            value = strings.TrimSpace(value[len(o):])
+            break
+        }
     }
 
-    var fids []int64
-    if this.Tag != nil && len(*this.Tag) > 0 {
-        fids, err = getFeedIdsByTags(session, *this.Tag)
-        if err != nil {
-            session.Rollback()
+    if m := relativeTimeRe.FindStringSubmatch(value); m != nil {
+        n, _ := strconv.Atoi(m[1])
+        var unit time.Duration
+        switch m[2] {
+            case "m": unit = time.Minute
+            case "h": unit = time.Hour
+            case "d": unit = 24 * time.Hour
+            case "w": unit = 7 * 24 * time.Hour
+        }
+        t := now.Add(-time.Duration(n) * unit)
+
+        // age < n means time > now - n
+        reverse := map[string]string{"<": ">", "<=": ">=", ">": "<", ">=": "<="}
+        o, ok := reverse[op]
+        if !ok {
+            err = fmt.Errorf("operator (<, <=, >, >=) is required for relative time")
             return
         }
+        sql = fmt.Sprintf("%s %s ?", column, o)
+        args = []interface{}{dbTime(t)}
+        return
     }
 
-    if this.Fid != nil {
-        fids = append(fids, *this.Fid...)
-    }
+    for i, layout := range timeLayouts {
+        t, e := time.ParseInLocation(layout, value, time.Local)
+        if e != nil {
+            continue
+        }
 
-    var where []string
-    if len(fids) > 0 {
-        var s []string
-        for _, fid := range fids {
-            s = append(s, strconv.FormatInt(fid, 10))
+        if op == "" || op == "=" {
+            if i == 0 {
+                sql = fmt.Sprintf("(%s >= ? and %s < ?)", column, column)
+                args = []interface{}{dbTime(t), dbTime(t.AddDate(0, 0, 1))}
+                return
+            }
+            op = "="
         }
-        where = append(where, fmt.Sprintf("Item.Fid in (%s)", strings.Join(s, ",")))
+        sql = fmt.Sprintf("%s %s ?", column, op)
+        args = []interface{}{dbTime(t)}
+        return
     }
 
-    var keywordSql []string // for combine sql of title and content
+    err = fmt.Errorf("time format is not correct")
+    return
+}
 
-    // the code below escape the single quotation for used in sql.
 
-    if this.Title != nil && len(*this.Title) > 0 {
-        for _, title := range *this.Title {
-            keywordSql = append(keywordSql, fmt.Sprintf("Item.Title like '%%%s%%'",
-                strings.Replace(title, "'", "''", -1)))
+// Escape a value for using in "like ... escape '\'".
+func likeArg(value string) string {
+    r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+    return "%" + r.Replace(value) + "%"
+}
+
+
+// Sql and bound parameters of search conditions.
+type searchSql struct {
+    args        []interface{}
+    rankQuery   []string        // FTS5 queries of keywords which are not negative, used for ranking
+}
+
+
+// Create sql of a term, which matches values in columns of Item. ftsColumns are columns of full-text index, e.g. "{Title Content}".
+func (this *searchSql) textTerm(columns []string, ftsColumns string, values []string, negative bool) string {
+    var or []string
+    var fts []string
+
+    for _, value := range values {
+        if ftsColumns != "" && ftsTerm(value) {
+            fts = append(fts, ftsColumnQuery(ftsColumns, value))
+            continue
+        }
+        for _, column := range columns {
+            or = append(or, column + ` like ? escape '\'`)
+            this.args = append(this.args, likeArg(value))
         }
     }
 
-    if this.Content != nil && len(*this.Content) > 0 {
-        for _, content := range *this.Content {
-            keywordSql = append(keywordSql, fmt.Sprintf("Item.Content like '%%%s%%'",
-                strings.Replace(content, "'", "''", -1)))
+    if len(fts) > 0 {
+        q := strings.Join(fts, " OR ")
+        or = append(or, "Item.Id in (select rowid from ItemFts where ItemFts match ?)")
+        this.args = append(this.args, q)
+        if !negative {
+            this.rankQuery = append(this.rankQuery, q)
         }
     }
 
-    if len(keywordSql) > 0 {
-        // where clause of title and content
-        where = append(where, "(" + strings.Join(keywordSql, " or ") + ")")
+    return "(" + strings.Join(or, " or ") + ")"
+}
+
+
+// Create sql of an expression, negative is true if the expression is in a "not" expression.
+func (this *searchSql) expr(expr *SearchExpr, negative bool, now time.Time) (sql string, err error) {
+
+    switch expr.Op {
+        case SEARCH_AND, SEARCH_OR:
+            var s []string
+            for _, e := range expr.Exprs {
+                sub, er := this.expr(e, negative, now)
+                if er != nil {
+                    err = er
+                    return
+                }
+                s = append(s, sub)
+            }
+            sql = "(" + strings.Join(s, " " + string(expr.Op) + " ") + ")"
+            return
+
+        case SEARCH_NOT:
+            sub, er := this.expr(expr.Exprs[0], !negative, now)
+            if er != nil {
+                err = er
+                return
+            }
+            sql = "not " + sub
+            return
+    }
+
+    placeholders := strings.TrimSuffix(strings.Repeat("?,", len(expr.Values)), ",")
+
+    switch expr.Key {
+        case "", "keyword":
+            sql = this.textTerm([]string{"Item.Title", "Item.Content"}, "{Title Content}", expr.Values, negative)
+
+        case "title":
+            sql = this.textTerm([]string{"Item.Title"}, "Title", expr.Values, negative)
+
+        case "content":
+            sql = this.textTerm([]string{"Item.Content"}, "Content", expr.Values, negative)
+
+        case "author":
+            sql = this.textTerm([]string{"Item.Author"}, "Author", expr.Values, negative)
+
+        case "url":
+            sql = this.textTerm([]string{"Item.Url"}, "", expr.Values, negative)
+
+        case "feed":
+            sql = this.textTerm([]string{"Feed.Name", "Feed.Alias"}, "", expr.Values, negative)
+
+        case "fid":
+            sql = fmt.Sprintf("Item.Fid in (%s)", placeholders)
+            for _, value := range expr.Values {
+                fid, _ := strconv.ParseInt(value, 10, 64)
+                this.args = append(this.args, fid)
+            }
+
+        case "tag":
+            // tags of feeds, and tags added to items by rules
+            sql = fmt.Sprintf("(Item.Fid in (select Fid from Tag where Name in (%s)) or Item.Id in (select Iid from ItemTag where Name in (%s)))",
+                placeholders, placeholders)
+            for i := 0; i < 2; i++ {
+                for _, value := range expr.Values {
+                    this.args = append(this.args, value)
+                }
+            }
+
+        case "pubtime", "fetchtime":
+            column := "Item.PubTime"
+            if expr.Key == "fetchtime" {
+                column = "Item.FetchTime"
+            }
+
+            var or []string
+            for _, value := range expr.Values {
+                s, args, e := timeCondition(column, value, now)
+                if e != nil {
+                    err = e
+                    return
+                }
+                or = append(or, s)
+                this.args = append(this.args, args...)
+            }
+            sql = "(" + strings.Join(or, " or ") + ")"
+
+        default:
+            err = fmt.Errorf("Do not support key: %s", expr.Key)
+    }
+
+    return
+}
+
+
+/*
+Get where clause (without "where") and bound parameters of the search query.
+rankQuery is a FTS5 query for ranking the result, it's empty if no keywords could be searched by full-text index.
+*/
+func (this *SearchQuery) whereSql() (where string, args []interface{}, rankQuery string, err error) {
+
+    var s searchSql
+    var w []string
+
+    if this.Expr != nil {
+        sql, e := s.expr(this.Expr, false, time.Now())
+        if e != nil {
+            err = e
+            return
+        }
+        w = append(w, sql)
     }
 
     if this.Read != nil {
         if *this.Read {
-            where = append(where, "Item.Read=1")
+            w = append(w, "Item.Read=1")
         } else {
-            where = append(where, "Item.Read=0")
+            w = append(w, "Item.Read=0")
         }
     }
 
     if this.Starred != nil {
         if *this.Starred {
-            where = append(where, "Item.Starred=1")
+            w = append(w, "Item.Starred=1")
         } else {
-            where = append(where, "Item.Starred=0")
+            w = append(w, "Item.Starred=0")
         }
     }
 
-    whereSql := strings.Join(where, " and ")
+    where = strings.Join(w, " and ")
+    args = s.args
+    rankQuery = strings.Join(s.rankQuery, " OR ")
+    return
+}
+
+
+// Count articles of search query.
+func (this *SearchQuery) count(session *xorm.Session) (number int64, err error) {
+
+    whereSql, args, _, err := this.whereSql()
+    if err != nil {
+        return
+    }
 
     sql := "select count(*) from Item inner join Feed on Item.Fid=Feed.Id"
     if len(whereSql) > 0 {
         sql += " where " + whereSql
     }
 
-    err = session.DB().QueryRow(sql).Scan(&list.Number)
+    err = session.DB().QueryRow(sql, args...).Scan(&number)
+    return
+}
+
+
+// Count unread articles of search query, option "read" of the search query is ignored.
+func (this *SearchQuery) countUnread(session *xorm.Session) (number int64, err error) {
+    f := false
+    q := *this
+    q.Read = &f
+    return q.count(session)
+}
+
+
+// Mark all the articles of search query read, option "read" of the search query is ignored.
+func (this *SearchQuery) MarkRead() (affected int64, err error) {
+    f := false
+    q := *this
+    q.Read = &f
+
+    whereSql, args, _, err := q.whereSql()
     if err != nil {
-        session.Rollback()
         return
     }
 
-    // place Feed.* as the last column to fit list.Articles structure.
-    sql = `select Item.Id, Item.Fid, Item.Author, Item.Url, Item.Guid, Item.Title, Item.PubTime,
-                Item.FetchTime, Item.Starred, Item.Read, Item.Hash, Feed.* from Item
-                inner join Feed on Item.Fid=Feed.Id`
+    sql := "update Item set Read=1 where Id in (select Item.Id from Item inner join Feed on Item.Fid=Feed.Id where " + whereSql + ")"
+    result, err := global.Orm.Exec(sql, args...)
+    if err != nil {
+        return
+    }
+    affected, err = result.RowsAffected()
+    return
+}
 
-    if len(whereSql) > 0 {
-        sql += " where " + whereSql
+
+// Get article list of search query by page, Num of the search query is the number of articles in a page.
+// cursor is optional, see ListByOffset().
+func (this *SearchQuery) List(page int, cursor ...string) (list ArticleList, err error) {
+
+    if this.Num == nil {
+        err = fmt.Errorf("'num' not provide for search query.")
+        return
     }
 
-    if this.Asc != nil && this.Orderby != nil {
-        var cols []string
+    return this.ListByOffset(*this.Num, (page - 1) * *this.Num, cursor...)
+}
+
+
+// Value of a column of an article used as a key of cursor.
+func cursorKey(a *Article, column string) string {
+    switch column {
+        case "id":          return strconv.FormatInt(a.Item.Id, 10)
+        case "fid":         return strconv.FormatInt(a.Item.Fid, 10)
+        case "author":      return a.Item.Author
+        case "url":         return a.Item.Url
+        case "guid":        return a.Item.Guid
+        case "title":       return a.Item.Title
+        case "pubtime":     return dbTime(a.Item.PubTime)
+        case "fetchtime":   return dbTime(a.Item.FetchTime)
+        case "starred":     return strconv.FormatBool(a.Item.Starred)
+        case "read":        return strconv.FormatBool(a.Item.Read)
+    }
+    return ""
+}
+
+
+// Convert a key of cursor to bound parameter of sql.
+func cursorArg(column, key string) (arg interface{}, err error) {
+    switch column {
+        case "id", "fid":
+            arg, err = strconv.ParseInt(key, 10, 64)
+        case "starred", "read":
+            var b bool
+            b, err = strconv.ParseBool(key)
+            if b {
+                arg = 1
+            } else {
+                arg = 0
+            }
+        default:
+            arg = key
+    }
+    if err != nil {
+        err = ErrInvalidCursor
+    }
+    return
+}
+
+
+/*
+Get article list of search query by limit and offset. Num of the search query is ignored.
+
+cursor is optional, it's the NextCursor of the previous page. If cursor is provided, offset is ignored.
+Cursor could not be used when the list is ordered by rank or content, and NextCursor will be empty.
+*/
+func (this *SearchQuery) ListByOffset(limit, offset int, cursor ...string) (list ArticleList, err error) {
+
+    whereSql, args, rankQuery, err := this.whereSql()
+    if err != nil {
+        return
+    }
+
+    var orderby []string
+    if this.Orderby != nil {
         for _, e := range *this.Orderby {
-            cols = append(cols, "`Item`.`" + e + "`")
+            orderby = append(orderby, strings.ToLower(e))
         }
+    }
 
-        s := fmt.Sprintf("order by %s", strings.Join(cols, ","))
+    orderByRank := false
+    cursorable := true
+    for _, e := range orderby {
+        if e == "rank" {
+            orderByRank = true
+        }
+        if e == "rank" || e == "content" {
+            cursorable = false
+        }
+    }
 
-        if *this.Asc {
-            s += " asc"
-        } else {
-            s += " desc"
+    var c articleCursor
+    useCursor := false
+    if len(cursor) > 0 {
+        c, useCursor, err = parseArticleCursor(cursor[0])
+        if err != nil {
+            return
+        }
+        if useCursor && !cursorable {
+            err = &SearchQueryError{Msg: "Cursor could not be used when ordering by rank or content."}
+            return
         }
+        if useCursor && len(c.Keys) != len(orderby) {
+            err = ErrInvalidCursor
+            return
+        }
+    }
+
+    session := global.Orm.NewSession()
+    defer session.Close()
 
-        sql += " " + s
+    err = session.Begin()
+    if err != nil {
+        return
     }
 
-    if this.Num == nil {
-        err = fmt.Errorf("'num' not provide for search query.")
+    list.Number, err = this.count(session)
+    if err != nil {
         session.Rollback()
         return
     }
 
-    sql = fmt.Sprintf("%s limit %d, %d", sql, (page - 1) * *this.Num, *this.Num)
+    fromSql := "from Item inner join Feed on Item.Fid=Feed.Id"
+
+    // rank is bm25 score of the full-text index, lower is more relevant.
+    rankSql := "0"
+    if rankQuery != "" && orderByRank {
+        fromSql += " left join (select rowid as FtsId, bm25(ItemFts) as FtsRank from ItemFts where ItemFts match ?) as Fts on Fts.FtsId=Item.Id"
+        rankSql = "-ifnull(Fts.FtsRank, 0)"
+        args = append([]interface{}{rankQuery}, args...)
+    }
 
-    err = session.Sql(sql).Find(&list.Articles)
+    // columns for ordering, Item.Id is the last one to make the order stable.
+    var cols []string
+    for _, e := range orderby {
+        if e == "rank" {
+            // larger value of rankSql is more relevant, so "order:desc" puts the most relevant articles first.
+            cols = append(cols, rankSql)
+            continue
+        }
+        cols = append(cols, "`Item`.`" + e + "`")
+    }
+    cols = append(cols, "`Item`.`Id`")
+
+    direction := " desc"
+    op := "<"
+    if this.Asc != nil && *this.Asc {
+        direction = " asc"
+        op = ">"
+    }
+
+    // articles after the cursor: (c1 > k1) or (c1 = k1 and c2 > k2) or ... (for asc order)
+    if useCursor {
+        var keys []interface{}
+        for i, e := range orderby {
+            k, er := cursorArg(e, c.Keys[i])
+            if er != nil {
+                session.Rollback()
+                err = er
+                return
+            }
+            keys = append(keys, k)
+        }
+        keys = append(keys, c.Id)
+
+        var or []string
+        for i := range cols {
+            var and []string
+            for j := 0; j < i; j++ {
+                and = append(and, cols[j] + " = ?")
+                args = append(args, keys[j])
+            }
+            and = append(and, cols[i] + " " + op + " ?")
+            args = append(args, keys[i])
+            or = append(or, "(" + strings.Join(and, " and ") + ")")
+        }
+
+        if len(whereSql) > 0 {
+            whereSql += " and "
+        }
+        whereSql += "(" + strings.Join(or, " or ") + ")"
+        offset = 0
+    }
+
+    if len(whereSql) > 0 {
+        whereSql = " where " + whereSql
+    }
+
+    sql := "select " + articleListColumns + " " + fromSql + whereSql
+
+    sql += " order by " + strings.Join(cols, direction + ",") + direction
+
+    sql = fmt.Sprintf("%s limit %d, %d", sql, offset, limit)
+
+    err = session.Sql(sql, args...).Find(&list.Articles)
+    if err != nil {
+        session.Rollback()
+        return
+    }
 
     session.Commit()
 
+    if cursorable && len(list.Articles) > 0 && len(list.Articles) >= limit {
+        last := list.Articles[len(list.Articles) - 1]
+        next := articleCursor{Id: last.Item.Id}
+        for _, e := range orderby {
+            next.Keys = append(next.Keys, cursorKey(last, e))
+        }
+        list.NextCursor = next.String()
+    }
+
     return
 }
-
@@ -0,0 +1,357 @@
+package model
+
+import "fmt"
+import "strings"
+import qp "github.com/m3ng9i/go-utils/query-parser"
+
+
+type SearchOp string
+const SEARCH_TERM   SearchOp = "term"
+const SEARCH_AND    SearchOp = "and"
+const SEARCH_OR     SearchOp = "or"
+const SEARCH_NOT    SearchOp = "not"
+
+
+/*
+A node of search expression.
+
+A term is like: [-]<key>:<value>[,<value>,...], values of a term are "or" relationship.
+A term without a known key is a keyword, e.g. http://example.com/post.
+Terms and groups are "and" relationship by default, "OR" (uppercase) could be used between them,
+parentheses are used for grouping, and a '-' before a term or group means "not", e.g.
+
+    linux -title:ubuntu (tag:news OR author:alice) pubtime:>2026-01-01
+*/
+type SearchExpr struct {
+    Op      SearchOp
+    Exprs   []*SearchExpr   // operands of "and", "or" and "not"
+    Key     string          // key of term, lower case
+    Values  []string        // values of term
+}
+
+
+// Token types of search query.
+const (
+    tokenTerm = iota
+    tokenAnd
+    tokenOr
+    tokenNot
+    tokenLeft
+    tokenRight
+)
+
+
+type searchToken struct {
+    typ     int
+    key     string
+    values  []string
+    raw     string
+}
+
+
+// Split a string by sep, which is not in quotes. Quotes are removed, '\' in quotes escapes the next character.
+func splitUnquoted(s string, sep rune, max int) (parts []string, quoted []bool, err error) {
+    var cur []rune
+    var quote rune
+    escape := false
+    hasQuote := false
+
+    for _, r := range s {
+        switch {
+            case escape:
+                cur = append(cur, r)
+                escape = false
+            case quote != 0 && r == '\\':
+                escape = true
+            case quote != 0 && r == quote:
+                quote = 0
+            case quote != 0:
+                cur = append(cur, r)
+            case r == '"' || r == '\'':
+                quote = r
+                hasQuote = true
+            case r == sep && (max <= 0 || len(parts) < max - 1):
+                parts = append(parts, string(cur))
+                quoted = append(quoted, hasQuote)
+                cur = nil
+                hasQuote = false
+            default:
+                cur = append(cur, r)
+        }
+    }
+
+    if quote != 0 {
+        err = fmt.Errorf("Quotation mark is not closed: %s", s)
+        return
+    }
+
+    parts = append(parts, string(cur))
+    quoted = append(quoted, hasQuote)
+    return
+}
+
+
+// Split search query to tokens.
+func tokenizeSearch(q string) (tokens []searchToken, err error) {
+
+    // split by white space and parentheses which are not in quotes
+    var words []string
+    var cur []rune
+    var quote rune
+    escape := false
+
+    flush := func() {
+        if len(cur) > 0 {
+            words = append(words, string(cur))
+            cur = nil
+        }
+    }
+
+    for _, r := range q {
+        switch {
+            case escape:
+                escape = false
+                cur = append(cur, r)
+            case quote != 0:
+                if r == '\\' {
+                    escape = true
+                } else if r == quote {
+                    quote = 0
+                }
+                cur = append(cur, r)
+            case r == '"' || r == '\'':
+                quote = r
+                cur = append(cur, r)
+            case r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '　':
+                flush()
+            case r == '(' || r == ')':
+                // '-' before '(' means "not"
+                if r == '(' && len(cur) == 1 && cur[0] == '-' {
+                    cur = nil
+                    words = append(words, "-")
+                } else {
+                    flush()
+                }
+                words = append(words, string(r))
+            default:
+                cur = append(cur, r)
+        }
+    }
+
+    if quote != 0 {
+        err = fmt.Errorf("Quotation mark is not closed.")
+        return
+    }
+    flush()
+
+    for _, word := range words {
+        switch word {
+            case "AND":
+                tokens = append(tokens, searchToken{typ: tokenAnd, raw: word})
+                continue
+            case "OR":
+                tokens = append(tokens, searchToken{typ: tokenOr, raw: word})
+                continue
+            case "-":
+                tokens = append(tokens, searchToken{typ: tokenNot, raw: word})
+                continue
+            case "(":
+                tokens = append(tokens, searchToken{typ: tokenLeft, raw: word})
+                continue
+            case ")":
+                tokens = append(tokens, searchToken{typ: tokenRight, raw: word})
+                continue
+        }
+
+        term := word
+        if strings.HasPrefix(term, "-") {
+            tokens = append(tokens, searchToken{typ: tokenNot, raw: "-"})
+            term = term[1:]
+        }
+
+        token := searchToken{typ: tokenTerm, raw: term}
+
+        parts, quoted, e := splitUnquoted(term, ':', 2)
+        if e != nil {
+            err = e
+            return
+        }
+        // only a known key is split from the value, so a keyword like http://example.com is not split
+        value := term
+        if len(parts) == 2 && !quoted[0] {
+            key := strings.ToLower(parts[0])
+            if key != "" && (isSearchOption(key) || isSearchCondition(key)) {
+                token.key = key
+                value = term[len(parts[0]) + 1:]
+            }
+        }
+
+        values, _, e := splitUnquoted(value, ',', 0)
+        if e != nil {
+            err = e
+            return
+        }
+        for _, v := range values {
+            if v != "" {
+                token.values = append(token.values, v)
+            }
+        }
+
+        tokens = append(tokens, token)
+    }
+
+    return
+}
+
+
+type searchParser struct {
+    tokens  []searchToken
+    pos     int
+}
+
+
+func (this *searchParser) peek() *searchToken {
+    if this.pos < len(this.tokens) {
+        return &this.tokens[this.pos]
+    }
+    return nil
+}
+
+
+// orExpr := andExpr ("OR" andExpr)*
+func (this *searchParser) parseOr() (expr *SearchExpr, err error) {
+    expr, err = this.parseAnd()
+    if err != nil {
+        return
+    }
+
+    for {
+        t := this.peek()
+        if t == nil || t.typ != tokenOr {
+            return
+        }
+        this.pos++
+
+        right, e := this.parseAnd()
+        if e != nil {
+            err = e
+            return
+        }
+
+        if expr.Op == SEARCH_OR {
+            expr.Exprs = append(expr.Exprs, right)
+        } else {
+            expr = &SearchExpr{Op: SEARCH_OR, Exprs: []*SearchExpr{expr, right}}
+        }
+    }
+}
+
+
+// andExpr := unary (["AND"] unary)*
+func (this *searchParser) parseAnd() (expr *SearchExpr, err error) {
+    var exprs []*SearchExpr
+
+    for {
+        t := this.peek()
+        if t == nil || t.typ == tokenOr || t.typ == tokenRight {
+            break
+        }
+        if t.typ == tokenAnd {
+            if len(exprs) == 0 {
+                err = &SearchQueryError{Msg: "'AND' should be placed between two conditions."}
+                return
+            }
+            this.pos++
+            continue
+        }
+
+        e, er := this.parseUnary()
+        if er != nil {
+            err = er
+            return
+        }
+        exprs = append(exprs, e)
+    }
+
+    switch len(exprs) {
+        case 0:
+            err = &SearchQueryError{Msg: "Condition is missing before or after 'OR', or in parentheses."}
+        case 1:
+            expr = exprs[0]
+        default:
+            expr = &SearchExpr{Op: SEARCH_AND, Exprs: exprs}
+    }
+    return
+}
+
+
+// unary := "-" unary | "(" orExpr ")" | term
+func (this *searchParser) parseUnary() (expr *SearchExpr, err error) {
+    t := this.peek()
+    if t == nil {
+        err = &SearchQueryError{Msg: "Condition is missing."}
+        return
+    }
+    this.pos++
+
+    switch t.typ {
+        case tokenNot:
+            e, er := this.parseUnary()
+            if er != nil {
+                err = er
+                return
+            }
+            expr = &SearchExpr{Op: SEARCH_NOT, Exprs: []*SearchExpr{e}}
+
+        case tokenLeft:
+            expr, err = this.parseOr()
+            if err != nil {
+                return
+            }
+            r := this.peek()
+            if r == nil || r.typ != tokenRight {
+                err = &SearchQueryError{Msg: "Parenthesis is not closed."}
+                return
+            }
+            this.pos++
+
+        case tokenTerm:
+            if len(t.values) == 0 {
+                err = &SearchQueryError{
+                    Node: qp.Node{Key: t.key},
+                    Msg: fmt.Sprintf("Value of '%s' is empty.", t.key),
+                }
+                return
+            }
+            expr = &SearchExpr{Op: SEARCH_TERM, Key: t.key, Values: t.values}
+
+        default:
+            err = &SearchQueryError{Msg: fmt.Sprintf("Unexpected '%s'.", t.raw)}
+    }
+    return
+}
+
+
+// Parse a search query to expression. If q is empty, expr is nil.
+func parseSearchExpr(q string) (expr *SearchExpr, err error) {
+    tokens, err := tokenizeSearch(q)
+    if err != nil {
+        err = &SearchQueryError{Msg: err.Error()}
+        return
+    }
+    if len(tokens) == 0 {
+        return
+    }
+
+    p := &searchParser{tokens: tokens}
+    expr, err = p.parseOr()
+    if err != nil {
+        return
+    }
+
+    if t := p.peek(); t != nil {
+        err = &SearchQueryError{Msg: fmt.Sprintf("Unexpected '%s'.", t.raw)}
+        expr = nil
+    }
+    return
+}
@@ -0,0 +1,189 @@
+package model
+
+import "reflect"
+import "strings"
+import "testing"
+
+
+// Format an expression for comparing, e.g. (or (and a b) (not title:c|d)).
+func formatSearchExpr(expr *SearchExpr) string {
+    if expr == nil {
+        return ""
+    }
+    if expr.Op == SEARCH_TERM {
+        value := strings.Join(expr.Values, "|")
+        if expr.Key == "" {
+            return value
+        }
+        return expr.Key + ":" + value
+    }
+
+    s := []string{string(expr.Op)}
+    for _, e := range expr.Exprs {
+        s = append(s, formatSearchExpr(e))
+    }
+    return "(" + strings.Join(s, " ") + ")"
+}
+
+
+func TestParseSearchExpr(t *testing.T) {
+    tests := []struct {
+        q       string
+        want    string
+    }{
+        {"", ""},
+        {"linux", "linux"},
+
+        // precedence: "and" binds tighter than "OR"
+        {"a b OR c", "(or (and a b) c)"},
+        {"a OR b c", "(or a (and b c))"},
+        {"a OR b OR c", "(or a b c)"},
+        {"a AND b OR c AND d", "(or (and a b) (and c d))"},
+
+        // negation
+        {"-title:ubuntu", "(not title:ubuntu)"},
+        {"linux -ubuntu", "(and linux (not ubuntu))"},
+        {"- a", "(not a)"},
+
+        // parentheses
+        {"(a OR b) c", "(and (or a b) c)"},
+        {"a (b OR (c d))", "(and a (or b (and c d)))"},
+        {"-(a OR b)", "(not (or a b))"},
+        {"x -(tag:news OR author:alice)", "(and x (not (or tag:news author:alice)))"},
+
+        // quoting
+        {`title:"hello world"`, "title:hello world"},
+        {`'a OR b'`, "a OR b"},
+        {`"(a)"`, "(a)"},
+        {`"a:b"`, "a:b"},
+        {`tag:"a,b",c`, "tag:a,b|c"},
+        {`"say \"hi\""`, `say "hi"`},
+
+        // keys and values
+        {"Title:x", "title:x"},
+        {"tag:a,b", "tag:a|b"},
+        {"pubtime:>2026-01-01", "pubtime:>2026-01-01"},
+        {"url:http://example.com/post", "url:http://example.com/post"},
+
+        // unknown keys are part of keywords
+        {"http://example.com/post", "http://example.com/post"},
+        {"https://example.com/a?b=1 OR c", "(or https://example.com/a?b=1 c)"},
+        {"foo:bar", "foo:bar"},
+        {":abc", ":abc"},
+    }
+
+    for _, test := range tests {
+        expr, err := parseSearchExpr(test.q)
+        if err != nil {
+            t.Errorf("%s: %s", test.q, err.Error())
+            continue
+        }
+        if got := formatSearchExpr(expr); got != test.want {
+            t.Errorf("%s: got '%s', want '%s'", test.q, got, test.want)
+        }
+    }
+}
+
+
+func TestParseSearchExprError(t *testing.T) {
+    tests := []string{
+        "(a",
+        "a)",
+        "()",
+        "a OR",
+        "OR a",
+        "AND a",
+        "a -",
+        `"abc`,
+        `title:'abc`,
+        "title:",
+        "tag:,",
+    }
+
+    for _, q := range tests {
+        expr, err := parseSearchExpr(q)
+        if err == nil {
+            t.Errorf("%s: error is expected, got '%s'", q, formatSearchExpr(expr))
+            continue
+        }
+        if _, ok := err.(*SearchQueryError); !ok {
+            t.Errorf("%s: error is not SearchQueryError: %s", q, err.Error())
+        }
+    }
+}
+
+
+func TestSearchKeywordWithColon(t *testing.T) {
+    sq, err := Search("http://example.com/post read:any")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := formatSearchExpr(sq.Expr); got != "http://example.com/post" {
+        t.Errorf("got '%s', want 'http://example.com/post'", got)
+    }
+
+    // options could not be negative
+    _, err = Search("-read:any")
+    if err == nil {
+        t.Error("error is expected for -read:any")
+    }
+}
+
+
+// Short keywords could not be searched by full-text index of trigram tokenizer, they are searched by "like".
+func TestSearchWhereSql(t *testing.T) {
+    defer func(enabled bool) {
+        ftsEnabled = enabled
+    }(ftsEnabled)
+
+    like := `(Item.Title like ? escape '\' or Item.Content like ? escape '\')`
+    match := `(Item.Id in (select rowid from ItemFts where ItemFts match ?))`
+
+    tests := []struct {
+        fts     bool
+        q       string
+        where   string
+        args    []interface{}
+        rank    string
+    }{
+        {true, "ab", like, []interface{}{"%ab%", "%ab%"}, ""},
+        {true, "abc", match, []interface{}{`{Title Content} : "abc"`}, `{Title Content} : "abc"`},
+        {true, "中文", like, []interface{}{"%中文%", "%中文%"}, ""},
+        {true, "中文字", match, []interface{}{`{Title Content} : "中文字"`}, `{Title Content} : "中文字"`},
+        {true, `'a"bc'`, match, []interface{}{`{Title Content} : "a""bc"`}, `{Title Content} : "a""bc"`},
+        {false, "abc", like, []interface{}{"%abc%", "%abc%"}, ""},
+        {true, "5%", like, []interface{}{`%5\%%`, `%5\%%`}, ""},
+
+        // negative keywords are not used for ranking
+        {true, "-abc", "not " + match, []interface{}{`{Title Content} : "abc"`}, ""},
+
+        {true, "title:ab,abc", `(Item.Title like ? escape '\' or Item.Id in (select rowid from ItemFts where ItemFts match ?))`,
+            []interface{}{"%ab%", `Title : "abc"`}, `Title : "abc"`},
+        {true, "url:http://example.com", `(Item.Url like ? escape '\')`, []interface{}{"%http://example.com%"}, ""},
+    }
+
+    for _, test := range tests {
+        ftsEnabled = test.fts
+
+        expr, err := parseSearchExpr(test.q)
+        if err != nil {
+            t.Errorf("%s: %s", test.q, err.Error())
+            continue
+        }
+        sq := SearchQuery{Expr: expr}
+        where, args, rank, err := sq.whereSql()
+        if err != nil {
+            t.Errorf("%s: %s", test.q, err.Error())
+            continue
+        }
+        if where != test.where {
+            t.Errorf("%s (fts: %v): got where '%s', want '%s'", test.q, test.fts, where, test.where)
+        }
+        if !reflect.DeepEqual(args, test.args) {
+            t.Errorf("%s (fts: %v): got args %v, want %v", test.q, test.fts, args, test.args)
+        }
+        if rank != test.rank {
+            t.Errorf("%s (fts: %v): got rank query '%s', want '%s'", test.q, test.fts, rank, test.rank)
+        }
+    }
+}
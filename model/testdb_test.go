@@ -0,0 +1,47 @@
+package model
+
+import "io/ioutil"
+import "os"
+import "path/filepath"
+import "testing"
+import "github.com/go-xorm/core"
+import "github.com/go-xorm/xorm"
+import "github.com/m3ng9i/go-utils/log"
+import "github.com/m3ng9i/qreader/global"
+
+
+/*
+Create an empty database in a temporary directory as global.Orm and global.PathDB, tables are created by InitDB().
+The returned function closes and removes the database, e.g. defer openTestDB(t)()
+*/
+func openTestDB(t *testing.T) (closeDB func()) {
+    dir, err := ioutil.TempDir("", "qreader-test")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if global.Logger == nil {
+        level, _ := log.String2Level("ERROR")
+        global.Logger, err = log.New(os.Stderr, log.Config{Level: level, TimeFormat: log.TF_DEFAULT})
+        if err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    global.PathDB = filepath.Join(dir, "feed.db")
+    global.Orm, err = xorm.NewEngine("sqlite3", global.PathDB + "?_foreign_keys=1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    global.Orm.SetMapper(core.SameMapper{})
+
+    err = InitDB()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return func() {
+        global.Orm.Close()
+        os.RemoveAll(dir)
+    }
+}
@@ -1,6 +1,8 @@
 package main
 
 import "time"
+import "bufio"
+import "context"
 import "flag"
 import "os"
 import "os/signal"
@@ -39,6 +41,14 @@ Options:
     -current-token              Show current api token.
     -defini                     Default content of config.ini.
     -open                       Open QReader web page on default browser.
+    -import-opml <file>         Import feeds from an OPML file, folders in the file will be saved as tags.
+    -export-opml <file>         Export subscriptions to an OPML file, tags will be saved as folders.
+    -export-json <file>         Export feeds, articles (with read and starred status) and tags to a JSON Lines file.
+    -import-json <file>         Import data exported by -export-json, merge it into current database.
+    -import-starred <file>      Import starred articles from starred.json of other readers or a bookmark file.
+    -migrate-status             Show current and target versions of database schema.
+    -backup <file>              Make a backup copy of database, could be used while QReader server is running.
+    -restore <file>             Replace database by a backup file, QReader server should be stopped first.
     -h, -help                   Show this message.
     -v, -version                Show version information.
 
@@ -73,19 +83,66 @@ func checkDBFile() error {
 }
 
 
+// Max time to wait for in-flight http requests and feed updating when shutting down.
+const shutdownTimeout = 30 * time.Second
+
+
+// Catch signals to shutdown QReader server gracefully. If a signal is caught again while shutting down, exit at once.
 func catchSignal() {
     signal_channel := make(chan os.Signal, 1)
     signal.Notify(signal_channel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
     go func() {
+        caught := false
         for value := range signal_channel {
+            if caught {
+                global.Logger.Warnf("Catch signal: %s again, QReader server exits at once", value.String())
+                global.Logger.Wait()
+                os.Exit(1)
+            }
+            caught = true
             global.Logger.Warnf("Catch signal: %s, QReader server is going to shutdown", value.String())
-            global.Logger.Wait()
-            os.Exit(0)
+            global.Shutdown()
         }
     }()
 }
 
 
+/*
+Shutdown QReader server gracefully: stop fetching feeds and automatic backup, wait for in-flight http requests
+to finish, fetched feeds to be saved and running backup to complete, then close the database.
+*/
+func shutdown(srv *http.Server, stopUpdating context.CancelFunc, updaterDone, backupDone <-chan struct{}) {
+    ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+    defer cancel()
+
+    stopUpdating()
+
+    err := srv.Shutdown(ctx)
+    if err != nil {
+        global.Logger.Errorf("[SYSTEM] Error occurs when shutting down http server: %s", err.Error())
+    }
+
+    select {
+        case <- updaterDone:
+        case <- ctx.Done():
+            global.Logger.Warn("[SYSTEM] Timeout when waiting for auto update to stop.")
+    }
+
+    select {
+        case <- backupDone:
+        case <- ctx.Done():
+            global.Logger.Warn("[SYSTEM] Timeout when waiting for automatic backup to stop.")
+    }
+
+    err = global.Orm.Close()
+    if err != nil {
+        global.Logger.Errorf("[SYSTEM] Error occurs when closing database: %s", err.Error())
+    }
+
+    global.Logger.Warn("QReader server is shutdown.")
+}
+
+
 func initDatabase() {
     err := model.InitDB()
     if err != nil {
@@ -108,6 +165,178 @@ func initConfigIni() {
 }
 
 
+// Print current and target versions of database schema.
+func migrateStatus() {
+    current, err := model.CurrentSchemaVersion()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when reading database version: %s\n", err.Error())
+        os.Exit(1)
+    }
+    target := model.TargetSchemaVersion()
+
+    fmt.Printf("Current version of database schema: %d\n", current)
+    fmt.Printf("Target version of database schema: %d\n", target)
+
+    if current < target {
+        fmt.Println("Database will be migrated when QReader starts, a backup copy of the database will be made before migrating.")
+    } else if current > target {
+        fmt.Println("Database is created by a newer version of QReader.")
+    } else {
+        fmt.Println("Database is up to date.")
+    }
+}
+
+
+// Make a backup copy of database.
+func backupDBFile(file string) {
+    err := model.BackupDB(file)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when backing up database: %s\n", err.Error())
+        os.Exit(1)
+    }
+    fmt.Printf("Database is backed up to %s.\n", file)
+}
+
+
+// Replace database by a backup file.
+func restoreDBFile(file string) {
+    backup, err := model.RestoreDB(file)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when restoring database: %s\n", err.Error())
+        os.Exit(1)
+    }
+    if backup != "" {
+        fmt.Printf("The original database is backed up to %s.\n", backup)
+    }
+    fmt.Printf("Database is restored from %s.\n", file)
+}
+
+
+// Import feeds from an OPML file and print the result of each feed.
+func importOpmlFile(file string) {
+    f, err := os.Open(file)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Cannot open OPML file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    defer f.Close()
+
+    results, err := model.ImportOpml(f)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when parsing OPML file: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    subscribed := 0
+    for _, r := range results {
+        switch r.Status {
+            case model.OPML_SUBSCRIBED:
+                subscribed++
+                fmt.Printf("[%s] %s (%s, %d articles)\n", r.Status, r.Url, r.Name, r.Number)
+                if r.Error != "" {
+                    fmt.Println("    " + r.Error)
+                }
+            case model.OPML_ALREADY_SUBSCRIBED:
+                fmt.Printf("[%s] %s\n", r.Status, r.Url)
+            default:
+                fmt.Printf("[%s] %s: %s\n", r.Status, r.Url, r.Error)
+        }
+    }
+    fmt.Printf("%d feeds found in OPML file, %d subscribed.\n", len(results), subscribed)
+}
+
+
+// Export subscriptions to an OPML file.
+func exportOpmlFile(file string) {
+    opml, err := model.ExportOpml()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when exporting subscriptions: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, global.Permission)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Cannot create OPML file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    defer f.Close()
+
+    err = opml.Write(f)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when writing OPML file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    fmt.Printf("Subscriptions exported to %s.\n", file)
+}
+
+
+// Export feeds, articles and tags to a JSON Lines file.
+func exportJsonFile(file string) {
+    f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, global.Permission)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Cannot create file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    defer f.Close()
+
+    w := bufio.NewWriter(f)
+    result, err := model.ExportData(w)
+    if err == nil {
+        err = w.Flush()
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when exporting data: %s\n", err.Error())
+        os.Exit(1)
+    }
+    fmt.Printf("%d feeds, %d articles and %d tags exported to %s.\n", result.Feeds, result.Items, result.Tags, file)
+}
+
+
+// Import data exported by -export-json and print the result.
+func importJsonFile(file string) {
+    f, err := os.Open(file)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Cannot open file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    defer f.Close()
+
+    result, err := model.ImportData(bufio.NewReader(f))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when importing data, nothing is imported: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    fmt.Printf("Feeds: %d added, %d already subscribed.\n", result.FeedsAdded, result.FeedsExisting)
+    fmt.Printf("Articles: %d added, %d already exist (read and starred status merged), %d skipped.\n",
+        result.ItemsAdded, result.ItemsMerged, result.ItemsSkipped)
+    fmt.Printf("Tags: %d added.\n", result.TagsAdded)
+}
+
+
+// Import starred articles exported by other readers and print the result.
+func importStarredFile(file string) {
+    f, err := os.Open(file)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Cannot open file: %s\n", err.Error())
+        os.Exit(1)
+    }
+    defer f.Close()
+
+    result, err := model.ImportStarred(f)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when importing starred articles: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    for _, e := range result.Errors {
+        fmt.Println("[rejected] " + e)
+    }
+    fmt.Printf("Format: %s. %d articles imported, %d duplicated, %d rejected, %d feeds created.\n",
+        result.Format, result.Imported, result.Duplicated, result.Rejected, result.Feeds)
+}
+
+
 func main() {
 
     global.Version = global.VersionType {
@@ -119,8 +348,8 @@ func main() {
 
     global.Github = _github_
 
-    var sitedata, input string
-    var init, initdb, help, version, currentToken, defini, open bool
+    var sitedata, input, importOpml, exportOpml, importJson, exportJson, importStarred, backup, restore string
+    var init, initdb, help, version, currentToken, defini, open, migrateStatusFlag bool
     flag.StringVar(&sitedata, "sitedata", "", "Directory of sitedata")
     flag.StringVar(&sitedata, "s", "", "Directory of sitedata")
     flag.BoolVar(&init, "init", false, "-init")
@@ -132,6 +361,14 @@ func main() {
     flag.BoolVar(&currentToken, "current-token", false, "-current-token")
     flag.BoolVar(&defini, "defini", false, "-defini")
     flag.BoolVar(&open, "open", false, "-open")
+    flag.StringVar(&importOpml, "import-opml", "", "-import-opml")
+    flag.StringVar(&exportOpml, "export-opml", "", "-export-opml")
+    flag.StringVar(&importJson, "import-json", "", "-import-json")
+    flag.StringVar(&exportJson, "export-json", "", "-export-json")
+    flag.StringVar(&importStarred, "import-starred", "", "-import-starred")
+    flag.BoolVar(&migrateStatusFlag, "migrate-status", false, "-migrate-status")
+    flag.StringVar(&backup, "backup", "", "-backup")
+    flag.StringVar(&restore, "restore", "", "-restore")
     flag.Usage = usage
     flag.Parse()
 
@@ -192,11 +429,29 @@ func main() {
         os.Exit(0)
     }
 
+    // restore database, config.ini is not required
+    if restore != "" {
+        fmt.Printf("Are you sure to replace QReader database by %s? Please make sure QReader server is stopped. ", restore)
+        fmt.Scanln(&input)
+        if len(input) > 0 && strings.ToLower(string(input[0])) == "y" {
+            restoreDBFile(restore)
+        } else {
+            fmt.Fprintln(os.Stderr, "Aborted to restore database.")
+        }
+        os.Exit(0)
+    }
+
     if !configIniExist {
         fmt.Fprintf(os.Stderr, "%s is not exist or not a regular file.\n", filepath.Join(global.Sitedata, "config.ini"))
         os.Exit(1)
     }
 
+    // api token is made from config.ini, the database is not opened
+    if currentToken {
+        fmt.Println(utils.CurrentToken())
+        os.Exit(0)
+    }
+
     // check if database is correct
     err := checkDBFile()
     if err != nil {
@@ -204,8 +459,48 @@ func main() {
         os.Exit(1)
     }
 
-    if currentToken {
-        fmt.Println(utils.CurrentToken())
+    if migrateStatusFlag {
+        migrateStatus()
+        os.Exit(0)
+    }
+
+    // backup before migrating, so the database is copied as it is
+    if backup != "" {
+        backupDBFile(backup)
+        os.Exit(0)
+    }
+
+    // Run pending migrations of database schema, a backup copy of the database is made before migrating.
+    // Options above only read the database or do not use it, so they do not migrate it.
+    err = model.UpgradeDB()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error occurs when upgrading database: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    if importOpml != "" {
+        importOpmlFile(importOpml)
+        global.Logger.Wait()
+        os.Exit(0)
+    }
+
+    if exportOpml != "" {
+        exportOpmlFile(exportOpml)
+        os.Exit(0)
+    }
+
+    if importJson != "" {
+        importJsonFile(importJson)
+        os.Exit(0)
+    }
+
+    if exportJson != "" {
+        exportJsonFile(exportJson)
+        os.Exit(0)
+    }
+
+    if importStarred != "" {
+        importStarredFile(importStarred)
         os.Exit(0)
     }
 
@@ -224,8 +519,12 @@ func main() {
     global.Logger.Infof("QReader %s.", Version)
     global.Logger.Infof("QReader is running. Open %s in your browser to use.", url)
 
-    // Auto update feed. Feed will be updated every 120 minutes (2 hours) default.
-    model.AutoUpdateFeed(120)
+    // Auto update feed. Feed will be updated every global.UpdateInterval minutes default.
+    updateCtx, stopUpdating := context.WithCancel(context.Background())
+    updaterDone := model.AutoUpdateFeed(updateCtx)
+
+    // Auto backup database and config.ini every global.BackupInterval hours, it stops with auto update.
+    backupDone := model.AutoBackup(updateCtx)
 
     if open {
         go func() {
@@ -238,13 +537,25 @@ func main() {
         }()
     }
 
-    if global.Usetls {
-        err = http.ListenAndServeTLS(addr, global.PathCertPem, global.PathKeyPem, server.Mux)
-    } else {
-        err = http.ListenAndServe(addr, server.Mux)
-    }
-    if err != nil {
-        fmt.Fprintf(os.Stderr, err.Error())
-        os.Exit(1)
+    srv := &http.Server{Addr: addr, Handler: server.Mux}
+    serverError := make(chan error, 1)
+
+    go func() {
+        if global.Usetls {
+            serverError <- srv.ListenAndServeTLS(global.PathCertPem, global.PathKeyPem)
+        } else {
+            serverError <- srv.ListenAndServe()
+        }
+    }()
+
+    select {
+        case err = <- serverError:
+            stopUpdating()
+            fmt.Fprintf(os.Stderr, err.Error())
+            global.Logger.Wait()
+            os.Exit(1)
+
+        case <- global.ShutdownRequested():
+            shutdown(srv, stopUpdating, updaterDone, backupDone)
     }
 }
@@ -45,6 +45,12 @@ func createRouter() martini.Router {
     router.Get(     "/api/feed/list",                               api.FeedList())
     router.Get(     "/api/feed/subscription",                       api.IsSubscribed())
     router.Post(    "/api/feed/subscription",                       api.Subscribe())
+    router.Get(     "/api/feed/discover",                           api.DiscoverFeed())
+    router.Post(    "/api/feed/import/opml",                        api.ImportOpml())
+    router.Get(     "/api/feed/export/opml",                        api.ExportOpml())
+    router.Post(    "/api/feed/import/json",                        api.ImportData())
+    router.Get(     "/api/feed/export/json",                        api.ExportData())
+    router.Post(    "/api/feed/import/starred",                     api.ImportStarred())
     router.Post(    "/api/feed/id/:id",                             api.Update())
     router.Get(     "/api/feed/id/:id",                             api.FeedInfo())
     router.Put(     "/api/feed/id/:id",                             api.UpdateFeedAndTags())
@@ -54,15 +60,35 @@ func createRouter() martini.Router {
     router.Get(     "/api/articles/fid/:fid/:limit/:offset",        api.ArticleList("fid"))
     router.Get(     "/api/articles/tag/:tag/:limit/:offset",        api.ArticleList("tag"))
     router.Get(     "/api/articles/starred/:limit/:offset",         api.ArticleList("starred"))
+    router.Get(     "/api/articles/unread/:limit",                  api.ArticleList("unread"))      // paging by cursor
+    router.Get(     "/api/articles/fid/:fid/:limit",                api.ArticleList("fid"))
+    router.Get(     "/api/articles/tag/:tag/:limit",                api.ArticleList("tag"))
+    router.Get(     "/api/articles/starred/:limit",                 api.ArticleList("starred"))
     router.Get(     "/api/articles/search/:deflimit",               api.SearchList())
+    router.Get(     "/api/articles/saved/:id/:limit/:offset",       api.SavedSearchArticleList())
+    router.Get(     "/api/articles/saved/:id/:limit",               api.SavedSearchArticleList())
     router.Put(     "/api/articles/read",                           api.MarkArticlesRead())
     router.Put(     "/api/articles/starred",                        api.MarkArticlesStarred())
     router.Get(     "/api/article/content/:id",                     api.Article())
+    router.Get(     "/api/article/revisions/:id",                   api.ArticleRevisions())
     router.Put(     "/api/article/read/:id",                        api.MarkReadStatus(true))   // mark read
     router.Put(     "/api/article/unread/:id",                      api.MarkReadStatus(false))  // mark unread
     router.Get(     "/api/tags/list",                               api.TagsList())
+    router.Get(     "/api/rules",                                   api.RuleList())
+    router.Post(    "/api/rules",                                   api.AddRule())
+    router.Post(    "/api/rules/dryrun",                            api.DryRunRule())
+    router.Get(     "/api/rules/id/:id",                            api.Rule())
+    router.Put(     "/api/rules/id/:id",                            api.UpdateRule())
+    router.Delete(  "/api/rules/id/:id",                            api.DeleteRule())
+    router.Get(     "/api/searches",                                api.SavedSearchList())
+    router.Post(    "/api/searches",                                api.AddSavedSearch())
+    router.Get(     "/api/searches/id/:id",                         api.SavedSearch())
+    router.Put(     "/api/searches/id/:id",                         api.UpdateSavedSearch())
+    router.Delete(  "/api/searches/id/:id",                         api.DeleteSavedSearch())
     router.Get(     "/api/system/settings",                         api.Settings())
     router.Put(     "/api/system/shutdown",                         api.CloseServer())
+    router.Post(    "/api/system/backup",                           api.BackupDB())
+    router.Post(    "/api/system/vacuum",                           api.VacuumDB())
     router.Get(     "/api/",                                        api.Status())               // do not need api token
     router.Get(     "/api/checktoken",                              api.Status())               // check api token
     router.Any(     "/api/**",                                      api.Default())
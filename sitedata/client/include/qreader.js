@@ -14,6 +14,7 @@ QReader.api.articlesTag         = QReader.apiroot + "articles/tag/";
 QReader.api.articlesStarred     = QReader.apiroot + "articles/starred/";
 QReader.api.articlesSearch      = QReader.apiroot + "articles/search/";
 QReader.api.article             = QReader.apiroot + "article/content/";
+QReader.api.articleRevisions    = QReader.apiroot + "article/revisions/";
 QReader.api.markArticleRead     = QReader.apiroot + "article/read/";
 QReader.api.markArticleUnread   = QReader.apiroot + "article/unread/";
 QReader.api.markArticlesRead    = QReader.apiroot + "articles/read";
@@ -682,7 +683,11 @@ QReader.app.controller("FeedInfoController", function($http, $scope, $route, $ro
             if (data.success) {
                 alert("保存成功");
             } else {
-                QDoc.SetError(data.error.errmsg);
+                if (data.error.errcode == 105) {
+                    QDoc.SetError("过滤器语法错误：" + data.error.errmsg);
+                } else {
+                    QDoc.SetError(data.error.errmsg);
+                }
             }
         });
     };
@@ -709,6 +714,8 @@ QReader.app.controller("FeedInfoController", function($http, $scope, $route, $ro
                 post.feed_max_keep      = parseInt($scope.data.feed_max_keep);
                 post.feed_max_unread    = parseInt($scope.data.feed_max_unread);
                 post.feed_interval      = parseInt($scope.data.feed_interval);
+                post.feed_filter        = $scope.data.feed_filter;
+                post.feed_mark_updated_unread = $scope.data.feed_mark_updated_unread;
 
                 if (post.feed_max_keep < 0 || post.feed_max_unread < 0) {
                     alert("最大已读保留数、最大未读保留数均不能小于0。")
@@ -786,6 +793,18 @@ QReader.app.controller("ArticleController", function($http, $scope, $routeParams
         });
     };
 
+    $scope.loadRevisions = function() {
+        QDoc.ClearError();
+
+        $http.get(QReader.api.articleRevisions + $routeParams.id).success(function(data) {
+            if (data.success) {
+                $scope.revisions = data.result;
+            } else {
+                QDoc.SetError(data.error.errmsg);
+            }
+        });
+    };
+
     $scope.markStarred = function(status) {
         QDoc.ClearError();
 
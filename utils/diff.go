@@ -0,0 +1,114 @@
+package utils
+
+import "html"
+import "strings"
+
+
+type DiffOpType string
+const DIFF_EQUAL    DiffOpType = "="    // text is in both old and new version
+const DIFF_DELETE   DiffOpType = "-"    // text is only in old version
+const DIFF_INSERT   DiffOpType = "+"    // text is only in new version
+
+
+// A piece of text of a diff, words of the text are separated by a space.
+type DiffOp struct {
+    Op          DiffOpType  `json:"op"`
+    Text        string      `json:"text"`
+}
+
+
+// Max size of the table for finding the longest common subsequence, larger changes are shown as a whole.
+const maxDiffCells = 1000000
+
+
+// Convert html to plain text: tags are removed, white spaces are collapsed. The result is not escaped.
+func PlainText(s string) string {
+    text := html.UnescapeString(strictPolicy.Sanitize(s))
+    return strings.Join(strings.Fields(text), " ")
+}
+
+
+// Append words with op to ops, adjacent words of the same op are merged.
+func appendDiff(ops []DiffOp, op DiffOpType, words ...string) []DiffOp {
+    if len(words) == 0 {
+        return ops
+    }
+    text := strings.Join(words, " ")
+    if n := len(ops); n > 0 && ops[n - 1].Op == op {
+        ops[n - 1].Text += " " + text
+        return ops
+    }
+    return append(ops, DiffOp{op, text})
+}
+
+
+/*
+Compare two plain texts word by word, by the longest common subsequence of words.
+The texts in the result are html escaped like other strings sanitized by Sanitize().
+*/
+func DiffWords(a, b string) (ops []DiffOp) {
+    x := strings.Fields(a)
+    y := strings.Fields(b)
+
+    // common prefix and suffix
+    prefix := 0
+    for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(x) - prefix && suffix < len(y) - prefix && x[len(x) - 1 - suffix] == y[len(y) - 1 - suffix] {
+        suffix++
+    }
+
+    ops = appendDiff(ops, DIFF_EQUAL, x[:prefix]...)
+
+    mx := x[prefix:len(x) - suffix]
+    my := y[prefix:len(y) - suffix]
+
+    if len(mx) * len(my) > maxDiffCells {
+        ops = appendDiff(ops, DIFF_DELETE, mx...)
+        ops = appendDiff(ops, DIFF_INSERT, my...)
+    } else {
+        // lcs[i][j] is the length of the longest common subsequence of mx[i:] and my[j:]
+        lcs := make([][]int, len(mx) + 1)
+        for i := range lcs {
+            lcs[i] = make([]int, len(my) + 1)
+        }
+        for i := len(mx) - 1; i >= 0; i-- {
+            for j := len(my) - 1; j >= 0; j-- {
+                if mx[i] == my[j] {
+                    lcs[i][j] = lcs[i + 1][j + 1] + 1
+                } else if lcs[i + 1][j] >= lcs[i][j + 1] {
+                    lcs[i][j] = lcs[i + 1][j]
+                } else {
+                    lcs[i][j] = lcs[i][j + 1]
+                }
+            }
+        }
+
+        i, j := 0, 0
+        for i < len(mx) && j < len(my) {
+            switch {
+                case mx[i] == my[j]:
+                    ops = appendDiff(ops, DIFF_EQUAL, mx[i])
+                    i++
+                    j++
+                case lcs[i + 1][j] >= lcs[i][j + 1]:
+                    ops = appendDiff(ops, DIFF_DELETE, mx[i])
+                    i++
+                default:
+                    ops = appendDiff(ops, DIFF_INSERT, my[j])
+                    j++
+            }
+        }
+        ops = appendDiff(ops, DIFF_DELETE, mx[i:]...)
+        ops = appendDiff(ops, DIFF_INSERT, my[j:]...)
+    }
+
+    ops = appendDiff(ops, DIFF_EQUAL, x[len(x) - suffix:]...)
+
+    for i := range ops {
+        ops[i].Text = html.EscapeString(ops[i].Text)
+    }
+    return
+}
@@ -2,6 +2,8 @@ package utils
 
 import "crypto/sha1"
 import "fmt"
+import "html"
+import "strings"
 import "time"
 import "github.com/microcosm-cc/bluemonday"
 import "github.com/m3ng9i/go-utils/timeslot"
@@ -80,6 +82,21 @@ func SanitizeSelf(s *string, normal ...bool) {
 }
 
 
+/*
+Make a plain text excerpt of n characters from html. Tags are removed, white spaces are collapsed,
+and "..." is appended if the text is cut. The result is html escaped like other strings sanitized by Sanitize().
+*/
+func Excerpt(s string, n int) string {
+    text := PlainText(s)
+
+    r := []rune(text)
+    if len(r) > n {
+        text = strings.TrimSpace(string(r[:n])) + "..."
+    }
+    return html.EscapeString(text)
+}
+
+
 func init() {
     strictPolicy = bluemonday.StrictPolicy()
     normalPolicy = bluemonday.UGCPolicy()